@@ -0,0 +1,109 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joanlopez/xk6-custosummary/importer"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/snapshot"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func runImport(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: custosummary import [flags] <file>")
+		fs.PrintDefaults()
+	}
+
+	var (
+		rf          renderFlags
+		out         string
+		inputFormat string
+		metricTypes string
+	)
+	rf.register(fs)
+	fs.StringVar(&out, "o", "", "path of the file to write the imported snapshot to")
+	fs.StringVar(&inputFormat, "input-format", "",
+		"format of the k6 output file: json or csv (default: from the file extension)")
+	fs.StringVar(&metricTypes, "metric-types", "",
+		"comma-separated list of custom metric types, only for csv (e.g. 'my_latency=trend:time,my_errors=counter')")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one file")
+	}
+
+	types, err := importer.ParseMetricTypes(metricTypes)
+	if err != nil {
+		return err
+	}
+
+	sinkTypes, err := trend.SinkTypesFromEnv()
+	if err != nil {
+		return err
+	}
+
+	s, err := importFile(fs.Arg(0), inputFormat, types, sinkTypes)
+	if err != nil {
+		return err
+	}
+
+	if len(out) > 0 {
+		if err := s.WriteFile(out); err != nil {
+			return fmt.Errorf("failed to write the imported snapshot: %w", err)
+		}
+	}
+
+	return render(s, rf, stdout)
+}
+
+// importFile reads the named file, written by one of the k6 outputs, as a snapshot.Snapshot.
+// If the format is empty, it is guessed from the file extension. Gzipped files (i.e. with
+// the .gz extension) are decompressed on the fly, as k6 can write them directly.
+func importFile(
+	name string, format string,
+	metricTypes map[string]timeseries.Meta, sinkTypes *trend.SinkTypes,
+) (snapshot.Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return snapshot.Snapshot{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	ext := filepath.Ext(name)
+	if ext == ".gz" {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return snapshot.Snapshot{}, err
+		}
+		defer func() { _ = gr.Close() }()
+
+		r = gr
+		ext = filepath.Ext(strings.TrimSuffix(name, ext))
+	}
+
+	if len(format) == 0 {
+		format = strings.TrimPrefix(ext, ".")
+	}
+
+	switch format {
+	case "json":
+		return importer.ReadJSON(r, sinkTypes)
+	case "csv":
+		return importer.ReadCSV(r, metricTypes, sinkTypes)
+	default:
+		return snapshot.Snapshot{}, fmt.Errorf("unknown input format '%s', possible values are: json, csv", format)
+	}
+}
@@ -0,0 +1,52 @@
+// Package main implements custosummary, a command-line tool to work with the
+// snapshots written by the xk6-custosummary output (see XK6_CUSTOSUMMARY_SNAPSHOT_PATH),
+// so the summary can be re-rendered offline, without re-running the test.
+// It can also import the files written by the built-in k6 outputs.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: custosummary <command> [flags] <args>
+
+Commands:
+  render    Renders the summary (or report) from a snapshot file.
+  merge     Merges several snapshot files (e.g. from distributed load generators),
+            and renders the summary (or report) from the result.
+  import    Imports a file written by the k6 JSON (--out json) or CSV (--out csv)
+            outputs, and renders the summary (or report) from it.
+
+Run 'custosummary <command> -h' for more information about a command.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(stderr, usage)
+		return fmt.Errorf("missing command")
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "render":
+		return runRender(args, stdout, stderr)
+	case "merge":
+		return runMerge(args, stdout, stderr)
+	case "import":
+		return runImport(args, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		_, _ = fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		_, _ = fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command '%s'", cmd)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/joanlopez/xk6-custosummary/snapshot"
+)
+
+func runMerge(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: custosummary merge [flags] <snapshot> <snapshot>...")
+		fs.PrintDefaults()
+	}
+
+	var (
+		rf  renderFlags
+		out string
+	)
+	rf.register(fs)
+	fs.StringVar(&out, "o", "", "path of the file to write the merged snapshot to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("expected at least two snapshot files")
+	}
+
+	snapshots := make([]snapshot.Snapshot, fs.NArg())
+	for i, name := range fs.Args() {
+		s, err := snapshot.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		snapshots[i] = s
+	}
+
+	merged, err := snapshot.Merge(snapshots...)
+	if err != nil {
+		return err
+	}
+
+	if len(out) > 0 {
+		if err := merged.WriteFile(out); err != nil {
+			return fmt.Errorf("failed to write the merged snapshot: %w", err)
+		}
+	}
+
+	return render(merged, rf, stdout)
+}
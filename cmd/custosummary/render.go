@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/guregu/null.v3"
+
+	"go.k6.io/k6/lib"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/snapshot"
+	"github.com/joanlopez/xk6-custosummary/summary"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// renderFlags holds the flags that define how the report and the summary are rendered.
+type renderFlags struct {
+	format        string
+	metrics       string
+	groupBy       string
+	trendStats    string
+	timeUnit      string
+	noColor       bool
+	baseline      string
+	tolerances    string
+	buckets       string
+	distributions string
+	confidence    string
+	apdex         string
+}
+
+func (rf *renderFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&rf.format, "format", "text", "output format: text, json or prometheus")
+	fs.StringVar(&rf.metrics, "metrics", "", "only include the metrics whose name matches this regexp")
+	fs.StringVar(&rf.groupBy, "group-by", "", "comma-separated list of tags to group the metrics by (e.g. scenario,group)")
+	fs.StringVar(&rf.trendStats, "trend-stats", strings.Join(lib.DefaultSummaryTrendStats, ","),
+		"comma-separated list of stats for trend metrics")
+	fs.StringVar(&rf.timeUnit, "time-unit", "", "time unit for trend metrics: s, ms or us (default: auto)")
+	fs.BoolVar(&rf.noColor, "no-color", false, "disable the colored output (text format only)")
+	fs.StringVar(&rf.baseline, "baseline", "", "snapshot or JSON report of a previous run to compare against")
+	fs.StringVar(&rf.tolerances, "tolerances", "",
+		"semicolon-separated list of tolerances against the baseline (e.g. 'http_req_duration:p(95)<=10%'), "+
+			"it fails if any is breached")
+	fs.StringVar(&rf.buckets, "buckets", "",
+		"semicolon-separated list of histogram bucket bounds of trend metrics (e.g. 'http_req_duration=50,100,250,500,1000')")
+	fs.StringVar(&rf.distributions, "distributions", "",
+		"comma-separated list of trend metrics whose distribution, in log-scaled buckets, is shown")
+	fs.StringVar(&rf.confidence, "confidence", "",
+		"confidence level (e.g. 0.95) of the intervals of percentiles and rates (default: disabled)")
+	fs.StringVar(&rf.apdex, "apdex", "",
+		"semicolon-separated list of Apdex targets of trend metrics (e.g. 'http_req_duration=500ms;my_trend=200')")
+}
+
+func runRender(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: custosummary render [flags] <snapshot>")
+		fs.PrintDefaults()
+	}
+
+	var rf renderFlags
+	rf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one snapshot file")
+	}
+
+	s, err := snapshot.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return render(s, rf, stdout)
+}
+
+// render writes the report (or the summary) built from the given
+// snapshot.Snapshot into the given io.Writer, as defined by renderFlags.
+func render(s snapshot.Snapshot, rf renderFlags, w io.Writer) error {
+	opts := lib.Options{
+		SummaryTrendStats: strings.Split(rf.trendStats, ","),
+		SummaryTimeUnit:   null.NewString(rf.timeUnit, len(rf.timeUnit) > 0),
+	}
+	if err := report.ValidateTrendStats(opts.SummaryTrendStats); err != nil {
+		return err
+	}
+
+	c := s.Collection
+	if len(rf.metrics) > 0 {
+		re, err := regexp.Compile(rf.metrics)
+		if err != nil {
+			return fmt.Errorf("invalid metrics regexp: %w", err)
+		}
+		c = c.Filter(func(k timeseries.Key) bool { return re.MatchString(k.MetricName()) })
+	}
+
+	r, err := report.From(c, s.Duration, opts)
+	if err != nil {
+		return err
+	}
+	if len(rf.groupBy) > 0 {
+		for _, tag := range strings.Split(rf.groupBy, ",") {
+			if err := r.AddGroups(c, strings.TrimSpace(tag), s.Duration, opts); err != nil {
+				return err
+			}
+		}
+	}
+
+	buckets, err := report.ParseBuckets(rf.buckets)
+	if err != nil {
+		return err
+	}
+	r.AddHistograms(c, buckets)
+
+	apdex, err := report.ParseApdexTargets(rf.apdex)
+	if err != nil {
+		return err
+	}
+	if err := r.AddApdex(c, apdex); err != nil {
+		return err
+	}
+
+	if len(rf.distributions) > 0 {
+		distributions := make(map[string]struct{})
+		for _, metric := range strings.Split(rf.distributions, ",") {
+			distributions[strings.TrimSpace(metric)] = struct{}{}
+		}
+		r.AddDistributions(c, func(name string) bool {
+			_, ok := distributions[name]
+			return ok
+		})
+	}
+
+	if len(rf.confidence) > 0 {
+		level, err := report.ParseConfidenceLevel(rf.confidence)
+		if err != nil {
+			return err
+		}
+		r.AddConfidenceIntervals(c, level)
+	}
+
+	tolerances, err := report.ParseTolerances(rf.tolerances)
+	if err != nil {
+		return err
+	}
+	if len(tolerances) > 0 && len(rf.baseline) == 0 {
+		return errors.New("tolerances require a baseline")
+	}
+
+	if len(rf.baseline) > 0 {
+		baseline, err := snapshot.ReadReportFile(rf.baseline, opts, apdex)
+		if err != nil {
+			return fmt.Errorf("failed to read the baseline: %w", err)
+		}
+		r.Compare(baseline)
+
+		var unchecked []report.Tolerance
+		r.Breaches, unchecked = r.CheckTolerances(tolerances)
+		if len(unchecked) > 0 {
+			return fmt.Errorf("tolerance '%s' couldn't be checked, the value is missing in the report or in the baseline", unchecked[0])
+		}
+	}
+
+	if err := write(r, opts, rf, w); err != nil {
+		return err
+	}
+
+	if len(r.Breaches) > 0 {
+		return fmt.Errorf("%d tolerance(s) against the baseline breached", len(r.Breaches))
+	}
+
+	return nil
+}
+
+// write writes the given report.Report (or the summary) into the given io.Writer,
+// in the format defined by renderFlags.
+func write(r report.Report, opts lib.Options, rf renderFlags, w io.Writer) error {
+	switch rf.format {
+	case "text":
+		layout := summary.Layout{Plain: rf.noColor}
+		if f, isFile := w.(*os.File); isFile {
+			layout = summary.LayoutFor(f, rf.noColor)
+		}
+		sum := summary.FromWith(r, opts, layout)
+		if rf.noColor {
+			sum = sum.WithoutColors()
+		}
+		_, err := fmt.Fprintln(w, strings.Join(sum, "\n"))
+		return err
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "prometheus":
+		return r.WritePrometheus(w)
+	default:
+		return fmt.Errorf("unknown format '%s', possible values are: text, json, prometheus", rf.format)
+	}
+}
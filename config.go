@@ -0,0 +1,242 @@
+package custosummary
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+)
+
+// Config holds the configuration of the output.
+//
+// It is loaded from the environment variables passed to k6
+// (see the constants below), so all the values are optional.
+type Config struct {
+	// HTTPAddr is the address (e.g. "localhost:6565") where the live
+	// report snapshots are served while the test is running.
+	// If empty (default), the HTTP server is disabled.
+	HTTPAddr string
+
+	// InterimInterval is how often an interim summary is rendered while
+	// the test is running. If zero (default), interim summaries are disabled.
+	InterimInterval time.Duration
+
+	// InterimOutput is where the interim summaries are written to.
+	// It can be either "stderr" (default) or a file path.
+	InterimOutput string
+
+	// InterimMode defines whether the interim summaries cover the
+	// whole test run so far (default) or only the last interval.
+	InterimMode InterimMode
+
+	// SnapshotPath is the path of the file where the snapshot of the
+	// collection is written to at the end of the test run, so the summary
+	// can be re-rendered offline (see cmd/custosummary).
+	// If empty (default), no snapshot is written.
+	SnapshotPath string
+
+	// BaselinePath is the path of a previous run's report, either a snapshot
+	// or a JSON-encoded report, to compare the summary against.
+	// If empty (default), no comparison is made.
+	BaselinePath string
+
+	// Tolerances are the maximum differences allowed against the baseline
+	// (see report.ParseTolerances). If any of them is breached, the test run fails.
+	Tolerances []report.Tolerance
+
+	// TrendSinkType is the trend.Sink implementation used by default for trend
+	// metrics: "k6" (default), "hdr" or "dds", and its parameters, if any
+	// (see trend.ParseSinkConfig).
+	TrendSinkType trend.SinkConfig
+
+	// TrendSinkTypes are the rules to select a different trend.Sink implementation
+	// for some trend metrics (see trend.ParseSinkTypeRules). They take precedence
+	// over the ones set from the script.
+	TrendSinkTypes []trend.SinkTypeRule
+
+	// TrendSinkCheck enables the accuracy self-check mode, where the approximate
+	// trend.Sink implementations are checked against an exact one, and the observed
+	// errors are reported in a separate section of the summary (see trend.CheckedSink).
+	TrendSinkCheck bool
+
+	// TrendStats are the stats of trend metrics shown in the summary (e.g. "avg",
+	// "p(95)", "stddev"). If empty (default), the k6 summaryTrendStats option is used,
+	// but k6 only accepts its built-in stats there (see report.ValidateTrendStats).
+	TrendStats []string
+
+	// Buckets are the upper bounds of the histogram buckets of some trend metrics,
+	// shown in the summary (see report.ParseBuckets). They take precedence over
+	// the ones set from the script.
+	Buckets report.Buckets
+
+	// Distributions are the names of the trend metrics whose distribution, in
+	// log-scaled buckets, is shown in the summary (see report.AddDistributions),
+	// besides the ones selected from the script.
+	Distributions []string
+
+	// ConfidenceLevel is the confidence level (e.g. 0.95) of the intervals of the
+	// percentiles and the rates shown in the summary (see report.AddConfidenceIntervals).
+	// If zero (default), no confidence intervals are calculated.
+	ConfidenceLevel float64
+
+	// Apdex are the Apdex targets T of some trend metrics, whose Apdex is shown in
+	// the summary (see report.ParseApdexTargets). They take precedence over the ones
+	// set from the script.
+	Apdex report.ApdexTargets
+}
+
+// InterimMode defines the period covered by interim summaries.
+type InterimMode string
+
+const (
+	// InterimCumulative makes interim summaries cover the whole test run so far.
+	InterimCumulative InterimMode = "cumulative"
+
+	// InterimWindow makes interim summaries cover only the last interval.
+	InterimWindow InterimMode = "window"
+)
+
+const (
+	httpAddrEnvVar        = "XK6_CUSTOSUMMARY_HTTP_ADDR"
+	interimIntervalEnvVar = "XK6_CUSTOSUMMARY_INTERIM_INTERVAL"
+	interimOutputEnvVar   = "XK6_CUSTOSUMMARY_INTERIM_OUTPUT"
+	interimModeEnvVar     = "XK6_CUSTOSUMMARY_INTERIM_MODE"
+	snapshotPathEnvVar    = "XK6_CUSTOSUMMARY_SNAPSHOT_PATH"
+	baselinePathEnvVar    = "XK6_CUSTOSUMMARY_BASELINE_PATH"
+	tolerancesEnvVar      = "XK6_CUSTOSUMMARY_TOLERANCES"
+	trendSinkTypeEnvVar   = "XK6_CUSTOSUMMARY_TRENDSINK_TYPE"
+	trendSinkTypesEnvVar  = "XK6_CUSTOSUMMARY_TRENDSINK_TYPES"
+	trendSinkCheckEnvVar  = "XK6_CUSTOSUMMARY_TRENDSINK_CHECK"
+	trendStatsEnvVar      = "XK6_CUSTOSUMMARY_TREND_STATS"
+	bucketsEnvVar         = "XK6_CUSTOSUMMARY_BUCKETS"
+	distributionsEnvVar   = "XK6_CUSTOSUMMARY_DISTRIBUTIONS"
+	confidenceLevelEnvVar = "XK6_CUSTOSUMMARY_CONFIDENCE_LEVEL"
+	apdexEnvVar           = "XK6_CUSTOSUMMARY_APDEX"
+)
+
+// newConfig loads the Config from the given environment variables.
+func newConfig(env map[string]string) (Config, error) {
+	cfg := Config{
+		InterimOutput: "stderr",
+		InterimMode:   InterimCumulative,
+		TrendSinkType: trend.DefaultSinkConfig("k6"),
+	}
+
+	if addr, ok := env[httpAddrEnvVar]; ok {
+		cfg.HTTPAddr = addr
+	}
+
+	if interval, ok := env[interimIntervalEnvVar]; ok && len(interval) > 0 {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < 0 {
+			return Config{}, fmt.Errorf("invalid %s '%s', provide a positive duration (e.g. 10m), "+
+				"or 0 to disable the interim summaries", interimIntervalEnvVar, interval)
+		}
+		cfg.InterimInterval = d
+	}
+
+	if out, ok := env[interimOutputEnvVar]; ok && len(out) > 0 {
+		cfg.InterimOutput = out
+	}
+
+	if mode, ok := env[interimModeEnvVar]; ok && len(mode) > 0 {
+		switch InterimMode(mode) {
+		case InterimCumulative, InterimWindow:
+			cfg.InterimMode = InterimMode(mode)
+		default:
+			return Config{}, fmt.Errorf("invalid %s '%s', possible values are: %s, %s",
+				interimModeEnvVar, mode, InterimCumulative, InterimWindow)
+		}
+	}
+
+	if path, ok := env[snapshotPathEnvVar]; ok {
+		cfg.SnapshotPath = path
+	}
+
+	if path, ok := env[baselinePathEnvVar]; ok {
+		cfg.BaselinePath = path
+	}
+
+	if tolerances, ok := env[tolerancesEnvVar]; ok && len(tolerances) > 0 {
+		parsed, err := report.ParseTolerances(tolerances)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", tolerancesEnvVar, err)
+		}
+		if len(cfg.BaselinePath) == 0 {
+			return Config{}, fmt.Errorf("%s requires a baseline, set %s", tolerancesEnvVar, baselinePathEnvVar)
+		}
+		cfg.Tolerances = parsed
+	}
+
+	if sinkType, ok := env[trendSinkTypeEnvVar]; ok && len(sinkType) > 0 {
+		parsed, err := trend.ParseSinkConfig(sinkType)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", trendSinkTypeEnvVar, err)
+		}
+		cfg.TrendSinkType = parsed
+	}
+
+	if rules, ok := env[trendSinkTypesEnvVar]; ok && len(rules) > 0 {
+		parsed, err := trend.ParseSinkTypeRules(rules)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", trendSinkTypesEnvVar, err)
+		}
+		cfg.TrendSinkTypes = parsed
+	}
+
+	if check, ok := env[trendSinkCheckEnvVar]; ok && len(check) > 0 {
+		parsed, err := strconv.ParseBool(check)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s '%s', possible values are: true, false", trendSinkCheckEnvVar, check)
+		}
+		cfg.TrendSinkCheck = parsed
+	}
+
+	if stats, ok := env[trendStatsEnvVar]; ok && len(stats) > 0 {
+		parsed := strings.Split(stats, ",")
+		for i := range parsed {
+			parsed[i] = strings.TrimSpace(parsed[i])
+		}
+		if err := report.ValidateTrendStats(parsed); err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", trendStatsEnvVar, err)
+		}
+		cfg.TrendStats = parsed
+	}
+
+	if buckets, ok := env[bucketsEnvVar]; ok && len(buckets) > 0 {
+		parsed, err := report.ParseBuckets(buckets)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", bucketsEnvVar, err)
+		}
+		cfg.Buckets = parsed
+	}
+
+	if distributions, ok := env[distributionsEnvVar]; ok && len(distributions) > 0 {
+		for _, metric := range strings.Split(distributions, ",") {
+			if metric = strings.TrimSpace(metric); len(metric) > 0 {
+				cfg.Distributions = append(cfg.Distributions, metric)
+			}
+		}
+	}
+
+	if level, ok := env[confidenceLevelEnvVar]; ok && len(level) > 0 {
+		parsed, err := report.ParseConfidenceLevel(level)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", confidenceLevelEnvVar, err)
+		}
+		cfg.ConfidenceLevel = parsed
+	}
+
+	if apdex, ok := env[apdexEnvVar]; ok && len(apdex) > 0 {
+		parsed, err := report.ParseApdexTargets(apdex)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", apdexEnvVar, err)
+		}
+		cfg.Apdex = parsed
+	}
+
+	return cfg, nil
+}
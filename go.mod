@@ -3,13 +3,19 @@ module github.com/joanlopez/xk6-custosummary
 go 1.22.3
 
 require (
+	github.com/DataDog/sketches-go v1.4.6
+	github.com/HdrHistogram/hdrhistogram-go v1.1.2
+	github.com/caio/go-tdigest v3.1.0+incompatible
+	github.com/mstoykov/atlas v0.0.0-20220811071828-388f114305dd
 	github.com/sirupsen/logrus v1.9.3
 	go.k6.io/k6 v0.54.0
+	golang.org/x/term v0.25.0
+	golang.org/x/text v0.20.0
+	google.golang.org/protobuf v1.35.1
+	gopkg.in/guregu/null.v3 v3.3.0
 )
 
 require (
-	github.com/DataDog/sketches-go v1.4.6 // indirect
-	github.com/HdrHistogram/hdrhistogram-go v1.1.2 // indirect
 	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
 	github.com/dlclark/regexp2 v1.11.4 // indirect
 	github.com/evanw/esbuild v0.21.2 // indirect
@@ -22,10 +28,10 @@ require (
 	github.com/grafana/sobek v0.0.0-20240829081756-447e8c611945 // indirect
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.22.0 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
+	github.com/leesper/go_rng v0.0.0-20190531154944-a612b043e353 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/mstoykov/atlas v0.0.0-20220811071828-388f114305dd // indirect
 	github.com/onsi/ginkgo v1.16.5 // indirect
 	github.com/onsi/gomega v1.35.0 // indirect
 	github.com/serenize/snaker v0.0.0-20201027110005-a7ad2135616e // indirect
@@ -40,11 +46,8 @@ require (
 	go.opentelemetry.io/proto/otlp v1.3.1 // indirect
 	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
-	golang.org/x/text v0.20.0 // indirect
 	golang.org/x/time v0.6.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240822170219-fc7c04adadcd // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240822170219-fc7c04adadcd // indirect
 	google.golang.org/grpc v1.65.0 // indirect
-	google.golang.org/protobuf v1.35.1 // indirect
-	gopkg.in/guregu/null.v3 v3.3.0 // indirect
 )
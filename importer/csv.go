@@ -0,0 +1,195 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/snapshot"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// The first columns written by the k6 CSV output, followed by the tags
+// (one column each), and the extra_tags and metadata columns.
+var csvFixedColumns = []string{"metric_name", "timestamp", "metric_value"}
+
+const (
+	csvExtraTagsColumn = "extra_tags"
+	csvMetadataColumn  = "metadata"
+)
+
+// ReadCSV reads the CSV file written by the k6 CSV output (i.e. `k6 run --out csv=results.csv`),
+// and builds a snapshot.Snapshot with all its samples. The test duration is the time elapsed
+// between the first and the last samples.
+//
+// As the CSV format doesn't include the metric types, those of the k6 built-in metrics are
+// known, and the ones of custom metrics must be given (see ParseMetricTypes). Timestamps are
+// accepted in any of the formats supported by the k6 CSV output (i.e. unix seconds, millis,
+// micros, nanos, or RFC3339), and tags from the extra_tags column are also included.
+// As with ReadJSON, the trend sinks are selected with the given trend.SinkTypes, if any.
+func ReadCSV(r io.Reader, metricTypes map[string]timeseries.Meta, sinkTypes *trend.SinkTypes) (snapshot.Snapshot, error) {
+	b := newBuilder(sinkTypes)
+	metrics.RegisterBuiltinMetrics(b.registry)
+
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return snapshot.Snapshot{}, fmt.Errorf("malformed CSV header: %w", err)
+	}
+	tagColumns, err := parseCSVHeader(header)
+	if err != nil {
+		return snapshot.Snapshot{}, err
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return snapshot.Snapshot{}, err
+		}
+
+		if err := b.addCSVRecord(record, tagColumns, metricTypes); err != nil {
+			line, _ := cr.FieldPos(0)
+			return snapshot.Snapshot{}, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	return b.snapshot(), nil
+}
+
+// parseCSVHeader validates the header, and returns the tag names, by column index.
+func parseCSVHeader(header []string) (map[int]string, error) {
+	if len(header) < len(csvFixedColumns) {
+		return nil, errors.New("malformed CSV header: missing columns")
+	}
+	for i, col := range csvFixedColumns {
+		if header[i] != col {
+			return nil, fmt.Errorf("malformed CSV header: expected column '%s', got '%s'", col, header[i])
+		}
+	}
+
+	tagColumns := make(map[int]string, len(header))
+	for i := len(csvFixedColumns); i < len(header); i++ {
+		tagColumns[i] = header[i]
+	}
+	return tagColumns, nil
+}
+
+func (b *builder) addCSVRecord(record []string, tagColumns map[int]string, metricTypes map[string]timeseries.Meta) error {
+	name := record[0]
+
+	m := b.registry.Get(name)
+	if m == nil {
+		meta, ok := metricTypes[name]
+		if !ok {
+			return fmt.Errorf("unknown type of custom metric %s, it must be given explicitly", name)
+		}
+
+		var err error
+		if m, err = b.metric(name, meta.Type, meta.Contains); err != nil {
+			return err
+		}
+	}
+
+	t, err := parseCSVTimestamp(record[1])
+	if err != nil {
+		return err
+	}
+
+	value, err := strconv.ParseFloat(record[2], 64)
+	if err != nil {
+		return fmt.Errorf("invalid metric value '%s'", record[2])
+	}
+
+	tags := make(map[string]string)
+	for i, tag := range tagColumns {
+		// The k6 CSV output writes an empty column for
+		// the tags not present in the sample.
+		if i >= len(record) || len(record[i]) == 0 {
+			continue
+		}
+
+		switch tag {
+		case csvMetadataColumn:
+			continue
+		case csvExtraTagsColumn:
+			for _, pair := range strings.Split(record[i], "&") {
+				if k, v, found := strings.Cut(pair, "="); found {
+					tags[k] = v
+				}
+			}
+		default:
+			tags[tag] = record[i]
+		}
+	}
+
+	b.addSample(m, tags, t, value)
+	return nil
+}
+
+// parseCSVTimestamp parses the timestamp in any of the formats supported by the
+// k6 CSV output. Unix timestamps precision is guessed from their magnitude.
+func parseCSVTimestamp(s string) (time.Time, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch abs := math.Abs(float64(n)); {
+		case abs < 1e11:
+			return time.Unix(n, 0), nil
+		case abs < 1e14:
+			return time.UnixMilli(n), nil
+		case abs < 1e17:
+			return time.UnixMicro(n), nil
+		default:
+			return time.Unix(0, n), nil
+		}
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp '%s'", s)
+	}
+	return t, nil
+}
+
+// ParseMetricTypes parses a comma-separated list of metric types, each one in the
+// `<metric>=<type>[:<contains>]` form (e.g. "my_latency=trend:time,my_errors=counter"),
+// as expected by ReadCSV for custom metrics.
+func ParseMetricTypes(s string) (map[string]timeseries.Meta, error) {
+	result := make(map[string]timeseries.Meta)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		name, rawType, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid metric type '%s', expected the <metric>=<type>[:<contains>] form", pair)
+		}
+
+		var meta timeseries.Meta
+		rawType, rawContains, hasContains := strings.Cut(rawType, ":")
+		if err := meta.Type.UnmarshalText([]byte(rawType)); err != nil {
+			return nil, fmt.Errorf("invalid metric type '%s': %w", pair, err)
+		}
+		if hasContains {
+			if err := meta.Contains.UnmarshalText([]byte(rawContains)); err != nil {
+				return nil, fmt.Errorf("invalid metric type '%s': %w", pair, err)
+			}
+		}
+
+		result[strings.TrimSpace(name)] = meta
+	}
+	return result, nil
+}
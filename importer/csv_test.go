@@ -0,0 +1,139 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// k6CSVLines are lines as written by `k6 run --out csv=results.csv` (v0.50).
+const k6CSVLines = `metric_name,timestamp,metric_value,check,error,error_code,expected_response,group,method,name,proto,scenario,service,status,subproto,tls_version,url,extra_tags,metadata
+http_reqs,1715328000,1.000000,,,,true,,GET,https://test.k6.io,HTTP/1.1,default,,200,,tls1.3,https://test.k6.io,,
+http_req_duration,1715328000,120.500000,,,,true,,GET,https://test.k6.io,HTTP/1.1,default,,200,,tls1.3,https://test.k6.io,,
+http_req_failed,1715328000,0.000000,,,,true,,GET,https://test.k6.io,HTTP/1.1,default,,200,,tls1.3,https://test.k6.io,,
+vus,1715328001,10.000000,,,,,,,,,,,,,,,,
+http_reqs,1715328002,1.000000,,,,false,,GET,https://test.k6.io,HTTP/1.1,default,,503,,tls1.3,https://test.k6.io,,
+http_req_duration,1715328002,300.000000,,,,false,,GET,https://test.k6.io,HTTP/1.1,default,,503,,tls1.3,https://test.k6.io,,
+http_req_failed,1715328002,1.000000,,,,false,,GET,https://test.k6.io,HTTP/1.1,default,,503,,tls1.3,https://test.k6.io,,
+checks,1715328002,1.000000,status is 200,,,,,,,,default,,,,,,,
+my_latency,1715328002,42.000000,,,,,,,,,default,,,,,,region=eu&tier=gold,
+vus,1715328003,5.000000,,,,,,,,,,,,,,,,
+`
+
+func TestReadCSV(t *testing.T) {
+	t.Parallel()
+
+	s, err := ReadCSV(strings.NewReader(k6CSVLines), map[string]timeseries.Meta{
+		"my_latency": {Type: metrics.Trend, Contains: metrics.Time},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertImported(t, s, 3*time.Second, map[string]map[string]float64{
+		"http_reqs":         {"count": 2},
+		"http_req_duration": {"count": 2, "min": 120.5, "max": 300},
+		"http_req_failed":   {"rate": 0.5, "passes": 1, "fails": 1},
+		"checks":            {"rate": 1, "passes": 1},
+		"my_latency":        {"count": 1, "max": 42},
+		"vus":               {"value": 5, "min": 5, "max": 10},
+	})
+
+	// The tags of each column, and those from the extra_tags one, are kept.
+	for _, key := range []timeseries.Key{
+		timeseries.NewKeyFromTags("http_reqs", map[string]string{"status": "503"}),
+		timeseries.NewKeyFromTags("checks", map[string]string{"check": "status is 200"}),
+		timeseries.NewKeyFromTags("my_latency", map[string]string{"region": "eu", "tier": "gold"}),
+	} {
+		if ts, err := s.Collection.Get(key); ts == nil || err != nil {
+			t.Errorf("expected a time series for %s, got %v (err=%v)", key, ts, err)
+		}
+	}
+}
+
+func TestReadCSVMalformed(t *testing.T) {
+	t.Parallel()
+
+	lines := strings.Split(k6CSVLines, "\n")
+	header, row := lines[0], lines[1]
+
+	for _, tc := range []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "empty", input: "", wantErr: "malformed CSV header"},
+		{name: "missing columns", input: "metric_name,timestamp\n", wantErr: "missing columns"},
+		{name: "unexpected column", input: "metric_name,time,metric_value\n", wantErr: "expected column 'timestamp', got 'time'"},
+		{name: "unknown custom metric", input: header + "\n" + lines[9] + "\n", wantErr: "line 2: unknown type of custom metric my_latency"},
+		{name: "invalid timestamp", input: header + "\n" + strings.Replace(row, "1715328000", "yesterday", 1) + "\n", wantErr: "line 2: invalid timestamp 'yesterday'"},
+		{name: "invalid value", input: header + "\n" + strings.Replace(row, "1.000000", "one", 1) + "\n", wantErr: "line 2: invalid metric value 'one'"},
+		{name: "truncated", input: header + "\n" + row + "\n" + row[:len(row)/2], wantErr: "wrong number of fields"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ReadCSV(strings.NewReader(tc.input), nil, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseCSVTimestamp(t *testing.T) {
+	t.Parallel()
+
+	want := time.Date(2024, 5, 10, 8, 0, 0, 0, time.UTC)
+	for _, input := range []string{
+		"1715328000",
+		"1715328000000",
+		"1715328000000000",
+		"1715328000000000000",
+		"2024-05-10T10:00:00+02:00",
+		"2024-05-10T08:00:00Z",
+	} {
+		got, err := parseCSVTimestamp(input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", input, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: expected %s, got %s", input, want, got)
+		}
+	}
+
+	for _, input := range []string{"", "1715328000.5", "2024-05-10"} {
+		if _, err := parseCSVTimestamp(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestParseMetricTypes(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseMetricTypes(" my_latency=trend:time, my_errors=counter ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]timeseries.Meta{
+		"my_latency": {Type: metrics.Trend, Contains: metrics.Time},
+		"my_errors":  {Type: metrics.Counter, Contains: metrics.Default},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for _, input := range []string{"my_latency", "my_latency=histogram", "my_latency=trend:seconds"} {
+		if _, err := ParseMetricTypes(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
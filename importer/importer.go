@@ -0,0 +1,82 @@
+// Package importer rebuilds snapshots (see the snapshot package) from the files
+// written by the built-in k6 outputs, so the customizable summary can be applied to
+// old test runs, or to test runs done with a k6 binary without this extension.
+package importer
+
+import (
+	"fmt"
+	"time"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/snapshot"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// builder builds a snapshot.Snapshot from individual samples, tracking
+// the first and last sample times to determine the test duration.
+type builder struct {
+	registry   *metrics.Registry
+	collection timeseries.Collection
+	sinkTypes  *trend.SinkTypes
+
+	first, last time.Time
+}
+
+// newBuilder returns a new builder, whose trend sinks are selected
+// with the given trend.SinkTypes, or the default ones if nil.
+func newBuilder(sinkTypes *trend.SinkTypes) *builder {
+	return &builder{
+		registry:   metrics.NewRegistry(),
+		collection: timeseries.NewCollection(),
+		sinkTypes:  sinkTypes,
+	}
+}
+
+// metric returns the *metrics.Metric with the given name, registering it if needed.
+// It returns an error if it was already registered with a different type.
+func (b *builder) metric(name string, mt metrics.MetricType, vt metrics.ValueType) (*metrics.Metric, error) {
+	m, err := b.registry.NewMetric(name, mt, vt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// addSample adds a sample of the given metric into the collection, and
+// also into those of its sub-metrics whose tags match the sample ones.
+func (b *builder) addSample(m *metrics.Metric, tags map[string]string, t time.Time, value float64) {
+	s := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m,
+			Tags:   b.registry.RootTagSet().WithTagsFromMap(tags),
+		},
+		Time:  t,
+		Value: value,
+	}
+
+	b.collection.AddMetricSampleWith(m, s, b.sinkTypes)
+	for _, sub := range m.Submetrics {
+		if s.Tags.Contains(sub.Tags) {
+			b.collection.AddMetricSampleWith(sub.Metric, s, b.sinkTypes)
+		}
+	}
+
+	if b.first.IsZero() || t.Before(b.first) {
+		b.first = t
+	}
+	if t.After(b.last) {
+		b.last = t
+	}
+}
+
+// snapshot returns the snapshot.Snapshot built so far, with its trend
+// values sorted, like the ones written by the output (see Collection.Sort).
+func (b *builder) snapshot() snapshot.Snapshot {
+	b.collection.Sort()
+	return snapshot.Snapshot{
+		Duration:   b.last.Sub(b.first),
+		Collection: b.collection,
+	}
+}
@@ -0,0 +1,103 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/snapshot"
+)
+
+// jsonEnvelope is each of the lines written by the k6 JSON output,
+// which can be either a "Metric" (definition) or a "Point" (sample).
+type jsonEnvelope struct {
+	Type   string          `json:"type"`
+	Metric string          `json:"metric"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type jsonMetric struct {
+	Name       string             `json:"name"`
+	Type       metrics.MetricType `json:"type"`
+	Contains   metrics.ValueType  `json:"contains"`
+	Submetrics []struct {
+		Suffix string `json:"suffix"`
+	} `json:"submetrics"`
+}
+
+type jsonPoint struct {
+	Time  time.Time         `json:"time"`
+	Value float64           `json:"value"`
+	Tags  map[string]string `json:"tags"`
+}
+
+// ReadJSON reads the newline-delimited JSON stream written by the k6 JSON output
+// (i.e. `k6 run --out json=results.json`), and builds a snapshot.Snapshot with
+// all its samples. The test duration is the time elapsed between the first and
+// the last samples. The trend sinks are selected with the given trend.SinkTypes,
+// or the default ones are used if nil.
+func ReadJSON(r io.Reader, sinkTypes *trend.SinkTypes) (snapshot.Snapshot, error) {
+	b := newBuilder(sinkTypes)
+	br := bufio.NewReader(r)
+
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if lineErr := b.addJSONLine(line); lineErr != nil {
+				return snapshot.Snapshot{}, fmt.Errorf("line %d: %w", lineNum, lineErr)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return snapshot.Snapshot{}, err
+		}
+	}
+
+	return b.snapshot(), nil
+}
+
+func (b *builder) addJSONLine(line []byte) error {
+	var env jsonEnvelope
+	if err := json.Unmarshal(line, &env); err != nil {
+		return fmt.Errorf("malformed JSON: %w", err)
+	}
+
+	switch env.Type {
+	case "Metric":
+		var jm jsonMetric
+		if err := json.Unmarshal(env.Data, &jm); err != nil {
+			return fmt.Errorf("malformed metric: %w", err)
+		}
+
+		m, err := b.metric(jm.Name, jm.Type, jm.Contains)
+		if err != nil {
+			return err
+		}
+		for _, sub := range jm.Submetrics {
+			if _, err := m.AddSubmetric(sub.Suffix); err != nil {
+				return fmt.Errorf("invalid sub-metric %s{%s}: %w", jm.Name, sub.Suffix, err)
+			}
+		}
+	case "Point":
+		var jp jsonPoint
+		if err := json.Unmarshal(env.Data, &jp); err != nil {
+			return fmt.Errorf("malformed point: %w", err)
+		}
+
+		m := b.registry.Get(env.Metric)
+		if m == nil {
+			return fmt.Errorf("point of unknown metric %s", env.Metric)
+		}
+		b.addSample(m, jp.Tags, jp.Time, jp.Value)
+	}
+
+	return nil
+}
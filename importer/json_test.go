@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.k6.io/k6/lib"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/snapshot"
+)
+
+// k6JSONLines are lines as written by `k6 run --out json=results.json` (v0.50).
+const k6JSONLines = `{"type":"Metric","data":{"name":"http_reqs","type":"counter","contains":"default","thresholds":[],"submetrics":null},"metric":"http_reqs"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:00.5+02:00","value":1,"tags":{"expected_response":"true","group":"","method":"GET","name":"https://test.k6.io","proto":"HTTP/1.1","scenario":"default","status":"200","url":"https://test.k6.io"}},"metric":"http_reqs"}
+{"type":"Metric","data":{"name":"http_req_duration","type":"trend","contains":"time","thresholds":["p(95)<500"],"submetrics":[{"name":"http_req_duration{expected_response:true}","suffix":"expected_response:true","tags":{"expected_response":"true"}}]},"metric":"http_req_duration"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:00.5+02:00","value":120.5,"tags":{"expected_response":"true","group":"","method":"GET","name":"https://test.k6.io","scenario":"default","status":"200"}},"metric":"http_req_duration"}
+{"type":"Metric","data":{"name":"http_req_failed","type":"rate","contains":"default","thresholds":[],"submetrics":null},"metric":"http_req_failed"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:00.5+02:00","value":0,"tags":{"expected_response":"true","group":"","method":"GET","name":"https://test.k6.io","scenario":"default","status":"200"}},"metric":"http_req_failed"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:01.5+02:00","value":1,"tags":{"expected_response":"true","group":"","method":"GET","name":"https://test.k6.io","scenario":"default","status":"200"}},"metric":"http_reqs"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:01.5+02:00","value":80.25,"tags":{"expected_response":"true","group":"","method":"GET","name":"https://test.k6.io","scenario":"default","status":"200"}},"metric":"http_req_duration"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:01.5+02:00","value":300,"tags":{"expected_response":"false","group":"","method":"GET","name":"https://test.k6.io","scenario":"default","status":"503"}},"metric":"http_req_duration"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:01.5+02:00","value":1,"tags":{"expected_response":"false","group":"","method":"GET","name":"https://test.k6.io","scenario":"default","status":"503"}},"metric":"http_req_failed"}
+{"type":"Metric","data":{"name":"vus","type":"gauge","contains":"default","thresholds":[],"submetrics":null},"metric":"vus"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:01+02:00","value":10,"tags":null},"metric":"vus"}
+{"type":"Point","data":{"time":"2024-05-10T10:00:02.5+02:00","value":5,"tags":null},"metric":"vus"}
+`
+
+func TestReadJSON(t *testing.T) {
+	t.Parallel()
+
+	s, err := ReadJSON(strings.NewReader(k6JSONLines), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertImported(t, s, 2*time.Second, map[string]map[string]float64{
+		"http_reqs":         {"count": 2},
+		"http_req_duration": {"count": 3, "min": 80.25, "max": 300},
+		"http_req_duration{expected_response:true}": {"count": 2, "min": 80.25, "max": 120.5},
+		"http_req_failed": {"rate": 0.5, "passes": 1, "fails": 1},
+		"vus":             {"value": 5, "min": 5, "max": 10},
+	})
+}
+
+func TestReadJSONMalformed(t *testing.T) {
+	t.Parallel()
+
+	lines := strings.Split(k6JSONLines, "\n")
+	metricLine, pointLine := lines[0], lines[1]
+
+	for _, tc := range []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "not json", input: "http_reqs,1\n", wantErr: "line 1: malformed JSON"},
+		{name: "truncated", input: metricLine + "\n" + pointLine[:len(pointLine)/2], wantErr: "line 2: malformed JSON"},
+		{name: "unknown metric", input: pointLine + "\n", wantErr: "line 1: point of unknown metric http_reqs"},
+		{
+			name:    "malformed point",
+			input:   metricLine + "\n" + strings.Replace(pointLine, `"value":1`, `"value":"1"`, 1) + "\n",
+			wantErr: "line 2: malformed point",
+		},
+		{
+			name:    "malformed metric",
+			input:   strings.Replace(metricLine, `"type":"counter"`, `"type":"histogram"`, 1) + "\n",
+			wantErr: "line 1: malformed metric",
+		},
+		{
+			name:    "redefined metric",
+			input:   metricLine + "\n" + strings.Replace(metricLine, `"type":"counter"`, `"type":"trend"`, 1) + "\n",
+			wantErr: "line 2: invalid metric http_reqs",
+		},
+		{
+			name:    "invalid sub-metric",
+			input:   lines[2][:strings.Index(lines[2], `"submetrics"`)] + `"submetrics":[{"suffix":""}]}}`,
+			wantErr: "line 1: invalid sub-metric http_req_duration{}",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ReadJSON(strings.NewReader(tc.input), nil)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// assertImported checks the duration of the given snapshot and the values of each
+// metric in the report built from it, as those are what the summary is made of.
+func assertImported(t *testing.T, s snapshot.Snapshot, wantDuration time.Duration, want map[string]map[string]float64) {
+	t.Helper()
+
+	if s.Duration != wantDuration {
+		t.Errorf("expected a duration of %s, got %s", wantDuration, s.Duration)
+	}
+
+	r, err := report.From(s.Collection, s.Duration, lib.Options{SummaryTrendStats: []string{"count", "min", "max"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Metrics) != len(want) {
+		t.Errorf("expected %d metrics, got %d", len(want), len(r.Metrics))
+	}
+	for name, values := range want {
+		metric, ok := r.Metrics[name]
+		if !ok {
+			t.Errorf("missing metric %s", name)
+			continue
+		}
+		for stat, value := range values {
+			if got := metric.Values[stat]; got != value {
+				t.Errorf("%s %s: expected %v, got %v", name, stat, value, got)
+			}
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package custosummary
 
 import (
+	"fmt"
 	"regexp"
 
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
 )
 
 type (
@@ -24,10 +28,16 @@ var (
 func (m ModuleInstance) Exports() modules.Exports {
 	return modules.Exports{
 		Named: map[string]interface{}{
-			"includeAllMetrics":    m.includeAllMetrics,
-			"excludeAllMetrics":    m.excludeAllMetrics,
-			"filterMetric":         m.filterMetric,
-			"filterMetricByRegexp": m.filterMetricByRegexp,
+			"includeAllMetrics":     m.includeAllMetrics,
+			"excludeAllMetrics":     m.excludeAllMetrics,
+			"filterMetric":          m.filterMetric,
+			"filterMetricByRegexp":  m.filterMetricByRegexp,
+			"query":                 m.query,
+			"trendSinkType":         m.trendSinkType,
+			"trendSinkTypeByRegexp": m.trendSinkTypeByRegexp,
+			"setBuckets":            m.setBuckets,
+			"showDistribution":      m.showDistribution,
+			"setApdex":              m.setApdex,
 		},
 	}
 }
@@ -79,3 +89,104 @@ func (m ModuleInstance) filterMetricByRegexp(re string) {
 	m.vu.InitEnv().Logger.Debugln("Metrics will be filtered by regexp '" + re + "'")
 	// TODO: Implement this.
 }
+
+// query returns the current value of the given stat (e.g. "p(95)") for the
+// metric selector (e.g. `http_req_duration{scenario="api"}`), or null if
+// there is no data for the selector yet.
+func (m ModuleInstance) query(selector, stat string) interface{} {
+	value, found, err := m.root.query(selector, stat)
+	if err != nil {
+		common.Throw(m.vu.Runtime(), err)
+		return nil
+	}
+
+	if !found {
+		return nil
+	}
+
+	return value
+}
+
+// trendSinkType makes the trend metric with the given name use the given sink
+// type (e.g. "k6", "hdr", "tdigest" or "dds(accuracy=0.001)"), instead of the default one.
+func (m ModuleInstance) trendSinkType(name, sinkType string) {
+	if m.vu.State() != nil {
+		m.vu.State().Logger.Errorln("'trendSinkType' must be called in the init context to take effect")
+		return
+	}
+
+	rule, err := trend.NewSinkTypeRule(name, sinkType)
+	if err != nil {
+		common.Throw(m.vu.Runtime(), err)
+		return
+	}
+
+	m.vu.InitEnv().Logger.Debugln("Metric '" + name + "' will use the '" + sinkType + "' trend sink")
+	m.root.trendSinkTypes.Add(rule)
+}
+
+// trendSinkTypeByRegexp makes the trend metrics whose name matches the given regexp
+// use the given sink type (e.g. "k6", "hdr" or "dds(accuracy=0.05)"), instead of the default one.
+func (m ModuleInstance) trendSinkTypeByRegexp(re, sinkType string) {
+	if m.vu.State() != nil {
+		m.vu.State().Logger.Errorln("'trendSinkTypeByRegexp' must be called in the init context to take effect")
+		return
+	}
+
+	rule, err := trend.NewSinkTypeRuleByRegexp(re, sinkType)
+	if err != nil {
+		common.Throw(m.vu.Runtime(), err)
+		return
+	}
+
+	m.vu.InitEnv().Logger.Debugln("Metrics matching regexp '" + re + "' will use the '" + sinkType + "' trend sink")
+	m.root.trendSinkTypes.Add(rule)
+}
+
+// setBuckets sets the upper bounds (e.g. [50, 100, 250, 500, 1000]) of the buckets
+// of the histogram of the trend metric with the given name, shown in the summary.
+func (m ModuleInstance) setBuckets(name string, bounds []float64) {
+	if m.vu.State() != nil {
+		m.vu.State().Logger.Errorln("'setBuckets' must be called in the init context to take effect")
+		return
+	}
+
+	if err := report.ValidateBounds(bounds); err != nil {
+		common.Throw(m.vu.Runtime(), fmt.Errorf("invalid buckets for the '%s' metric: %w", name, err))
+		return
+	}
+
+	m.vu.InitEnv().Logger.Debugln("Metric '" + name + "' will have a histogram in the summary")
+	m.root.setBuckets(name, bounds)
+}
+
+// showDistribution makes the summary show the distribution of the values of the
+// trend metric with the given name, in log-scaled buckets, under its stats.
+func (m ModuleInstance) showDistribution(name string) {
+	if m.vu.State() != nil {
+		m.vu.State().Logger.Errorln("'showDistribution' must be called in the init context to take effect")
+		return
+	}
+
+	m.vu.InitEnv().Logger.Debugln("Metric '" + name + "' will have its distribution shown in the summary")
+	m.root.showDistribution(name)
+}
+
+// setApdex sets the Apdex target T of the trend metric with the given name, either as
+// a number, in the unit of its values, or as a duration (e.g. "500ms"), so its Apdex
+// (and the ones of its sub-metrics) is shown in the summary.
+func (m ModuleInstance) setApdex(name string, t string) {
+	if m.vu.State() != nil {
+		m.vu.State().Logger.Errorln("'setApdex' must be called in the init context to take effect")
+		return
+	}
+
+	parsed, err := report.ParseApdexTarget(t)
+	if err != nil {
+		common.Throw(m.vu.Runtime(), fmt.Errorf("invalid Apdex target for the '%s' metric: %w", name, err))
+		return
+	}
+
+	m.vu.InitEnv().Logger.Debugln("Metric '" + name + "' will have its Apdex in the summary")
+	m.root.setApdex(name, parsed)
+}
@@ -0,0 +1,144 @@
+package custosummary
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/summary"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// interimReporter renders summaries periodically while the test is running,
+// so there are checkpoints available even if the test run crashes.
+//
+// It is driven by the periodic flusher (see RootModule.flushMetrics),
+// so its precision is bounded by the flush interval.
+type interimReporter struct {
+	interval   time.Duration
+	mode       InterimMode
+	opts       lib.Options
+	confidence float64
+
+	w      io.Writer
+	plain  bool
+	layout summary.Layout
+	close  func() error
+
+	start, last time.Time
+
+	// window holds the samples received since the last
+	// interim summary, only used in InterimWindow mode.
+	window timeseries.Collection
+	types  *trend.SinkTypes
+
+	// extras adds the histograms, the distributions and the Apdex
+	// of the trend metrics to the report (see RootModule.addExtras).
+	extras func(report.Report, timeseries.Collection) error
+}
+
+// newInterimReporter initializes a new interimReporter from the given Config,
+// opening the output file if necessary.
+func newInterimReporter(
+	cfg Config, types *trend.SinkTypes, extras func(report.Report, timeseries.Collection) error,
+	opts lib.Options, stderr io.Writer,
+) (*interimReporter, error) {
+	ir := &interimReporter{
+		interval:   cfg.InterimInterval,
+		mode:       cfg.InterimMode,
+		opts:       opts,
+		confidence: cfg.ConfidenceLevel,
+		types:      types,
+		extras:     extras,
+		w:          stderr,
+		close:      func() error { return nil },
+	}
+
+	if cfg.InterimOutput != "stderr" {
+		f, err := os.OpenFile(cfg.InterimOutput, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the interim summaries output: %w", err)
+		}
+		ir.w, ir.plain, ir.close = f, true, f.Close
+	}
+	ir.layout = summary.Layout{Plain: ir.plain}
+	if f, isFile := ir.w.(*os.File); isFile {
+		ir.layout = summary.LayoutFor(f, ir.plain)
+	}
+
+	if ir.mode == InterimWindow {
+		ir.window = timeseries.NewCollection()
+	}
+
+	return ir, nil
+}
+
+// begin marks the beginning of the test run.
+func (ir *interimReporter) begin(now time.Time) {
+	ir.start, ir.last = now, now
+}
+
+// addSample registers the sample into the current window, if needed.
+func (ir *interimReporter) addSample(m *metrics.Metric, s metrics.Sample) {
+	if ir.window != nil {
+		ir.window.AddMetricSampleWith(m, s, ir.types)
+	}
+}
+
+// next builds the report for the next interim summary from the given
+// collection, if the configured interval has elapsed since the last one.
+// Otherwise, it returns false. It returns an error if the report cannot be built.
+//
+// The returned report doesn't refer to the collection anymore, so it can be
+// rendered (see render) once the lock that guards the collection is released.
+func (ir *interimReporter) next(c timeseries.Collection, now time.Time) (string, report.Report, bool, error) {
+	if now.Sub(ir.last) < ir.interval {
+		return "", report.Report{}, false, nil
+	}
+
+	elapsed := now.Sub(ir.start).Round(time.Second)
+	header := fmt.Sprintf("Interim summary at %s (cumulative)", elapsed)
+
+	duration := now.Sub(ir.start)
+	if ir.window != nil {
+		header = fmt.Sprintf("Interim summary at %s (last %s)", elapsed, now.Sub(ir.last).Round(time.Second))
+		c, duration = ir.window, now.Sub(ir.last)
+		ir.window = timeseries.NewCollection()
+	}
+	ir.last = now
+
+	r, err := report.From(c, duration, ir.opts)
+	if err != nil {
+		return header, r, true, err
+	}
+	if err := ir.extras(r, c); err != nil {
+		return header, r, true, err
+	}
+	if ir.confidence > 0 {
+		r.AddConfidenceIntervals(c, ir.confidence)
+	}
+
+	return header, r, true, nil
+}
+
+// render writes the interim summary of the given report, under the given header.
+func (ir *interimReporter) render(header string, r report.Report) error {
+	s := summary.FromWith(r, ir.opts, ir.layout)
+	if ir.plain {
+		_, err := fmt.Fprintf(ir.w, "%s\n\n%s\n\n", header, strings.Join(s.WithoutColors(), "\n"))
+		return err
+	}
+
+	if _, err := fmt.Fprintf(ir.w, "\n%s\n\n", header); err != nil {
+		return err
+	}
+	_, err := s.WriteTo(ir.w)
+	return err
+}
@@ -3,6 +3,7 @@ package custosummary
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -12,6 +13,9 @@ import (
 	"go.k6.io/k6/output"
 
 	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/server"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/snapshot"
 	"github.com/joanlopez/xk6-custosummary/summary"
 	"github.com/joanlopez/xk6-custosummary/timeseries"
 )
@@ -19,12 +23,19 @@ import (
 // TODO: Parameterize
 const (
 	flushInterval = 1 * time.Second
+
+	serverStopTimeout = 5 * time.Second
 )
 
 func init() {
 	// Initialize the global RootModule instance accessor.
 	root := &RootModule{
-		Collection: timeseries.NewCollection(),
+		Collection:     timeseries.NewCollection(),
+		trendSinkTypes: trend.NewSinkTypes(),
+		buckets:        make(report.Buckets),
+		distributions:  make(map[string]struct{}),
+		apdex:          make(report.ApdexTargets),
+		queries:        make(map[queryKey]queryResult),
 	}
 
 	New = func() *RootModule { return root }
@@ -41,12 +52,36 @@ type (
 	// instances for each VU.
 	RootModule struct {
 		params output.Params
+		config Config
 
 		start time.Time
 		timeseries.Collection
 
+		// trendSinkTypes selects the trend.Sink implementation of each
+		// trend metric, from the config and from the JS module.
+		trendSinkTypes *trend.SinkTypes
+
+		// buckets, distributions and apdex hold the histogram buckets, the
+		// metrics whose distribution is shown, and the Apdex targets, set
+		// from the JS module (see setBuckets, showDistribution and setApdex).
+		buckets       report.Buckets
+		distributions map[string]struct{}
+		apdex         report.ApdexTargets
+		extrasMu      sync.Mutex
+
+		// mu guards the Collection, which is written by the periodic
+		// flusher and read by the JS module (see query).
+		mu sync.RWMutex
+
+		// queries caches the results of query until the next flush.
+		queries   map[queryKey]queryResult
+		queriesMu sync.Mutex
+
 		output.SampleBuffer
 		periodicFlusher *output.PeriodicFlusher
+		server          *server.Server
+		interim         *interimReporter
+		baseline        *report.Report
 		logger          logrus.FieldLogger
 	}
 )
@@ -63,8 +98,21 @@ var New func() *RootModule
 // NewOutput is a wrapper on top of New, that uses the given output.Params
 // and returns (the same) output.Output instance.
 func NewOutput(params output.Params) (output.Output, error) {
+	config, err := newConfig(params.Environment)
+	if err != nil {
+		return nil, err
+	}
+
 	root := New()
+	if err := root.trendSinkTypes.Configure(config.TrendSinkType, config.TrendSinkTypes); err != nil {
+		return nil, err
+	}
+	root.trendSinkTypes.SetCheck(config.TrendSinkCheck)
+	if len(config.TrendStats) > 0 {
+		params.ScriptOptions.SummaryTrendStats = config.TrendStats
+	}
 	root.params = params
+	root.config = config
 	root.logger = params.Logger
 	return root, nil
 }
@@ -86,14 +134,49 @@ func (*RootModule) Description() string {
 func (rm *RootModule) Start() error {
 	rm.logger.Debug("Starting output...")
 
+	if len(rm.config.BaselinePath) > 0 {
+		// The Apdex targets set from the JS module are already known, because
+		// the init context runs before the output is started.
+		baseline, err := snapshot.ReadReportFile(rm.config.BaselinePath, rm.params.ScriptOptions, rm.apdexTargets())
+		if err != nil {
+			return fmt.Errorf("failed to read the baseline: %w", err)
+		}
+		rm.baseline = &baseline
+	}
+
+	// Everything read by the flusher and by the server must be set
+	// before they're started, as they run on their own goroutines.
+	rm.start = time.Now()
+
+	if rm.config.InterimInterval > 0 {
+		ir, err := newInterimReporter(rm.config, rm.trendSinkTypes, rm.addExtras, rm.params.ScriptOptions, rm.params.StdErr)
+		if err != nil {
+			return err
+		}
+		ir.begin(rm.start)
+		rm.interim = ir
+	}
+
+	if len(rm.config.HTTPAddr) > 0 {
+		srv := server.New(rm.config.HTTPAddr, rm.snapshot, rm.params.ScriptOptions, rm.logger)
+		if err := srv.Start(); err != nil {
+			rm.closeInterim()
+			return fmt.Errorf("failed to start the HTTP server: %w", err)
+		}
+		rm.server = srv
+	}
+
 	pf, err := output.NewPeriodicFlusher(flushInterval, rm.flushMetrics)
 	if err != nil {
+		if rm.server != nil {
+			_ = rm.server.Stop(serverStopTimeout)
+		}
+		rm.closeInterim()
 		return err
 	}
+	rm.periodicFlusher = pf
 
 	rm.logger.Debug("Started!")
-	rm.start = time.Now()
-	rm.periodicFlusher = pf
 
 	return nil
 }
@@ -106,11 +189,65 @@ func (rm *RootModule) StopWithTestError(err error) error {
 
 	rm.periodicFlusher.Stop()
 
-	r := report.From(rm.Collection, time.Since(rm.start), rm.params.ScriptOptions)
-	s := summary.From(r, rm.params.ScriptOptions)
+	if rm.server != nil {
+		if err := rm.server.Stop(serverStopTimeout); err != nil {
+			rm.logger.WithError(err).Warn("Failed to stop the HTTP server gracefully")
+		}
+	}
+
+	rm.closeInterim()
+
+	testDuration := time.Since(rm.start)
+
+	for name, n := range rm.OutOfRange() {
+		rm.logger.Warnf("%d value(s) of the '%s' metric were out of the range of its trend sink, "+
+			"and they are missing in the summary; consider adjusting its parameters", n, name)
+	}
+
+	// No more samples are collected, so the trend values are sorted once, and
+	// the report (as well as the ones built from the snapshot) merges them as is.
+	rm.Collection.Sort()
+
+	if len(rm.config.SnapshotPath) > 0 {
+		s := snapshot.Snapshot{Duration: testDuration, Collection: rm.Collection}
+		if err := s.WriteFile(rm.config.SnapshotPath); err != nil {
+			rm.logger.WithError(err).Error("Failed to write the snapshot")
+		}
+	}
+
+	r, err := report.From(rm.Collection, testDuration, rm.params.ScriptOptions)
+	if err != nil {
+		return fmt.Errorf("failed to build the report: %w", err)
+	}
+	if err := rm.addExtras(r, rm.Collection); err != nil {
+		return fmt.Errorf("failed to build the report: %w", err)
+	}
+	if rm.config.ConfidenceLevel > 0 {
+		r.AddConfidenceIntervals(rm.Collection, rm.config.ConfidenceLevel)
+	}
+	var unchecked []report.Tolerance
+	if rm.baseline != nil {
+		r.Compare(*rm.baseline)
+		r.Breaches, unchecked = r.CheckTolerances(rm.config.Tolerances)
+	}
+	layout := summary.LayoutFor(os.Stdout, len(rm.params.Environment["NO_COLOR"]) > 0)
+	s := summary.FromWith(r, rm.params.ScriptOptions, layout)
+	if layout.Plain {
+		s = s.WithoutColors()
+	}
 	_, _ = fmt.Fprintln(os.Stdout) // FIXME: Handle error.
 	_, _ = s.WriteTo(os.Stdout)    // FIXME: Handle error.
 
+	// As with the `custosummary render` command, a tolerance that couldn't be
+	// checked fails the test run, as it most likely has a typo in it.
+	if len(unchecked) > 0 {
+		return fmt.Errorf("tolerance '%s' couldn't be checked, the value is missing in the report or in the baseline", unchecked[0])
+	}
+
+	if len(r.Breaches) > 0 {
+		return fmt.Errorf("%d tolerance(s) against the baseline breached", len(r.Breaches))
+	}
+
 	return nil
 }
 
@@ -119,6 +256,116 @@ func (rm *RootModule) Stop() error {
 	return rm.StopWithTestError(nil)
 }
 
+// snapshot returns a report.Report with the current state of the Collection.
+func (rm *RootModule) snapshot() (report.Report, error) {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	r, err := report.From(rm.Collection, time.Since(rm.start), rm.params.ScriptOptions)
+	if err != nil {
+		return report.Report{}, err
+	}
+	if err := rm.addExtras(r, rm.Collection); err != nil {
+		return report.Report{}, err
+	}
+	if rm.config.ConfidenceLevel > 0 {
+		r.AddConfidenceIntervals(rm.Collection, rm.config.ConfidenceLevel)
+	}
+	if rm.baseline != nil {
+		r.Compare(*rm.baseline)
+	}
+	return r, nil
+}
+
+// closeInterim closes the interim summaries output, if any.
+func (rm *RootModule) closeInterim() {
+	if rm.interim == nil {
+		return
+	}
+
+	if err := rm.interim.close(); err != nil {
+		rm.logger.WithError(err).Warn("Failed to close the interim summaries output")
+	}
+}
+
+// setBuckets sets the histogram buckets of the trend metric with the given name.
+func (rm *RootModule) setBuckets(metric string, bounds []float64) {
+	rm.extrasMu.Lock()
+	defer rm.extrasMu.Unlock()
+
+	rm.buckets[metric] = bounds
+}
+
+// showDistribution makes the distribution of the trend metric with the given name shown.
+func (rm *RootModule) showDistribution(metric string) {
+	rm.extrasMu.Lock()
+	defer rm.extrasMu.Unlock()
+
+	rm.distributions[metric] = struct{}{}
+}
+
+// setApdex sets the Apdex target T of the trend metric with the given name.
+func (rm *RootModule) setApdex(metric string, t report.ApdexTarget) {
+	rm.extrasMu.Lock()
+	defer rm.extrasMu.Unlock()
+
+	rm.apdex[metric] = t
+}
+
+// addExtras adds the histograms, the distributions and the Apdex of the trend metrics
+// to the given report, from the given collection. For the histogram buckets and the Apdex
+// targets, the ones from the config take precedence over the ones set from the JS module
+// (see setBuckets and setApdex). It returns an error if any Apdex target doesn't apply to
+// its metric (see report.Report.AddApdex).
+func (rm *RootModule) addExtras(r report.Report, c timeseries.Collection) error {
+	rm.extrasMu.Lock()
+	buckets := make(report.Buckets, len(rm.buckets)+len(rm.config.Buckets))
+	for metric, bounds := range rm.buckets {
+		buckets[metric] = bounds
+	}
+	for metric, bounds := range rm.config.Buckets {
+		buckets[metric] = bounds
+	}
+
+	distributions := make(map[string]struct{}, len(rm.distributions)+len(rm.config.Distributions))
+	for metric := range rm.distributions {
+		distributions[metric] = struct{}{}
+	}
+	for _, metric := range rm.config.Distributions {
+		distributions[metric] = struct{}{}
+	}
+	rm.extrasMu.Unlock()
+
+	r.AddHistograms(c, buckets)
+	if err := r.AddApdex(c, rm.apdexTargets()); err != nil {
+		return err
+	}
+	if len(distributions) > 0 {
+		r.AddDistributions(c, func(name string) bool {
+			_, ok := distributions[name]
+			return ok
+		})
+	}
+
+	return nil
+}
+
+// apdexTargets returns the Apdex targets of the trend metrics, where the ones
+// from the config take precedence over the ones set from the JS module.
+func (rm *RootModule) apdexTargets() report.ApdexTargets {
+	rm.extrasMu.Lock()
+	defer rm.extrasMu.Unlock()
+
+	apdex := make(report.ApdexTargets, len(rm.apdex)+len(rm.config.Apdex))
+	for metric, t := range rm.apdex {
+		apdex[metric] = t
+	}
+	for metric, t := range rm.config.Apdex {
+		apdex[metric] = t
+	}
+	return apdex
+}
+
 func (rm *RootModule) loggerWithError(err error) logrus.FieldLogger {
 	logger := rm.logger
 	if err != nil {
@@ -128,6 +375,8 @@ func (rm *RootModule) loggerWithError(err error) logrus.FieldLogger {
 }
 
 func (rm *RootModule) flushMetrics() {
+	rm.mu.Lock()
+
 	samples := rm.GetBufferedSamples()
 	for _, sc := range samples {
 		samples := sc.GetSamples()
@@ -135,13 +384,107 @@ func (rm *RootModule) flushMetrics() {
 			rm.flushSample(sample)
 		}
 	}
+
+	if len(samples) > 0 {
+		// The cached query results are outdated now.
+		rm.queriesMu.Lock()
+		clear(rm.queries)
+		rm.queriesMu.Unlock()
+	}
+
+	rm.mu.Unlock()
+
+	if rm.interim != nil {
+		rm.renderInterim(time.Now())
+	}
+}
+
+// renderInterim renders an interim summary, if it's due.
+//
+// The report is built under the read lock, but it's rendered once released,
+// so neither the JS queries nor the HTTP server wait for the output to be written.
+// That's safe because the interim reporter is only used from the flusher.
+func (rm *RootModule) renderInterim(now time.Time) {
+	rm.mu.RLock()
+	header, r, due, err := rm.interim.next(rm.Collection, now)
+	rm.mu.RUnlock()
+
+	if !due {
+		return
+	}
+
+	if err == nil {
+		err = rm.interim.render(header, r)
+	}
+	if err != nil {
+		rm.logger.WithError(err).Warn("Failed to write the interim summary")
+	}
 }
 
 func (rm *RootModule) flushSample(s metrics.Sample) {
 	// We register the metric and its sub-metrics,
 	// and we add the sample value to their sinks.
-	rm.AddSample(s)
+	rm.AddMetricSampleWith(s.Metric, s, rm.trendSinkTypes)
 	for _, sub := range s.Metric.Submetrics {
-		rm.AddMetricSample(sub.Metric, s)
+		rm.AddMetricSampleWith(sub.Metric, s, rm.trendSinkTypes)
+	}
+
+	if rm.interim != nil {
+		rm.interim.addSample(s.Metric, s)
+		for _, sub := range s.Metric.Submetrics {
+			rm.interim.addSample(sub.Metric, s)
+		}
+	}
+}
+
+type (
+	queryKey struct {
+		key  timeseries.Key
+		stat string
+	}
+
+	queryResult struct {
+		value float64
+		found bool
+	}
+)
+
+// query returns the current value of the given stat for the time series that
+// match the given selector (see timeseries.ParseSelector), and whether there
+// was any matching time series.
+//
+// Results are cached until the next flush, so it is cheap enough to call it
+// repeatedly, like on every iteration.
+func (rm *RootModule) query(selector, stat string) (float64, bool, error) {
+	key, err := timeseries.ParseSelector(selector)
+	if err != nil {
+		return 0, false, err
+	}
+
+	qk := queryKey{key: key, stat: stat}
+
+	rm.queriesMu.Lock()
+	res, cached := rm.queries[qk]
+	rm.queriesMu.Unlock()
+	if cached {
+		return res.value, res.found, nil
 	}
+
+	rm.mu.RLock()
+	ts, err := rm.Get(key)
+	if ts != nil {
+		res.found = true
+		res.value, err = report.Stat(ts, stat, time.Since(rm.start))
+	}
+	rm.mu.RUnlock()
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	rm.queriesMu.Lock()
+	rm.queries[qk] = res
+	rm.queriesMu.Unlock()
+
+	return res.value, res.found, nil
 }
@@ -0,0 +1,177 @@
+package custosummary
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"go.k6.io/k6/metrics"
+	"go.k6.io/k6/output"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// newTestRootModule returns a new RootModule, like the global one, but
+// not registered, so each test can have its own, and already started.
+func newTestRootModule(t *testing.T) *RootModule {
+	t.Helper()
+
+	return &RootModule{
+		Collection: timeseries.NewCollection(),
+		queries:    make(map[queryKey]queryResult),
+		start:      time.Now(),
+	}
+}
+
+func TestQueryCacheIsInvalidatedOnFlush(t *testing.T) {
+	t.Parallel()
+
+	rm := newTestRootModule(t)
+
+	registry := metrics.NewRegistry()
+	m := registry.MustNewMetric("my_trend", metrics.Trend, metrics.Time)
+	add := func(value float64, tags map[string]string) {
+		rm.AddMetricSamples([]metrics.SampleContainer{metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: m, Tags: registry.RootTagSet().WithTagsFromMap(tags)},
+			Value:      value,
+			Time:       time.Now(),
+		}})
+	}
+
+	assertQuery := func(selector, stat string, want float64, wantFound bool) {
+		t.Helper()
+
+		got, found, err := rm.query(selector, stat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want || found != wantFound {
+			t.Fatalf("%s %s: expected %v (found=%v), got %v (found=%v)", selector, stat, want, wantFound, got, found)
+		}
+	}
+
+	assertQuery("my_trend", "count", 0, false)
+
+	add(100, map[string]string{"scenario": "api"})
+	rm.flushMetrics()
+	assertQuery("my_trend", "count", 1, true)
+	assertQuery("my_trend", "max", 100, true)
+
+	// Until the next flush, the cached results are returned.
+	add(300, map[string]string{"scenario": "web"})
+	assertQuery("my_trend", "count", 1, true)
+
+	rm.flushMetrics()
+	assertQuery("my_trend", "count", 2, true)
+	assertQuery("my_trend", "max", 300, true)
+	assertQuery(`my_trend{scenario="api"}`, "max", 100, true)
+	assertQuery(`my_trend{scenario="other"}`, "count", 0, false)
+
+	if _, _, err := rm.query("my_trend{scenario", "count"); err == nil {
+		t.Fatal("expected an error for a malformed selector")
+	}
+	if _, _, err := rm.query("my_trend", "p(101)"); err == nil {
+		t.Fatal("expected an error for an unknown stat")
+	}
+}
+
+func TestInterimSummaryIsRenderedOutsideTheLock(t *testing.T) {
+	t.Parallel()
+
+	rm := newTestRootModule(t)
+
+	var rendered, locked bool
+	rm.interim = &interimReporter{
+		interval: time.Second,
+		mode:     InterimCumulative,
+		w: writerFunc(func(p []byte) (int, error) {
+			rendered = true
+			if rm.mu.TryLock() {
+				locked = true
+				rm.mu.Unlock()
+			}
+			return len(p), nil
+		}),
+		plain:  true,
+		close:  func() error { return nil },
+		extras: rm.addExtras,
+	}
+	rm.interim.begin(time.Now().Add(-time.Minute))
+
+	rm.flushMetrics()
+
+	if !rendered {
+		t.Fatal("expected the interim summary to be rendered")
+	}
+	if !locked {
+		t.Fatal("expected the interim summary to be rendered without holding the lock")
+	}
+}
+
+// writerFunc is an io.Writer implemented by a function.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestStopFailsOnTolerances(t *testing.T) {
+	t.Parallel()
+
+	baseline := report.Report{Metrics: map[string]report.Metric{
+		"my_counter": {
+			Meta:   timeseries.Meta{Type: metrics.Counter, Contains: metrics.Default},
+			Values: report.Values{"count": 10},
+		},
+	}}
+
+	for _, tc := range []struct {
+		name       string
+		tolerances string
+		wantErr    string
+	}{
+		{name: "satisfied", tolerances: "my_counter:count<=0"},
+		{name: "breached", tolerances: "my_counter:count>=0", wantErr: "1 tolerance(s) against the baseline breached"},
+		{name: "unchecked", tolerances: "my_countr:count<=0", wantErr: "tolerance 'my_countr:count<=+0' couldn't be checked"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tolerances, err := report.ParseTolerances(tc.tolerances)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+
+			rm := newTestRootModule(t)
+			rm.logger = logger
+			rm.baseline = &baseline
+			rm.config.Tolerances = tolerances
+			rm.periodicFlusher, err = output.NewPeriodicFlusher(time.Hour, rm.flushMetrics)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The counter gets 5 values, so its count is lower than in the baseline.
+			registry := metrics.NewRegistry()
+			m := registry.MustNewMetric("my_counter", metrics.Counter)
+			rm.AddMetricSamples([]metrics.SampleContainer{metrics.Sample{
+				TimeSeries: metrics.TimeSeries{Metric: m, Tags: registry.RootTagSet()},
+				Value:      5,
+				Time:       time.Now(),
+			}})
+
+			err = rm.StopWithTestError(nil)
+			switch {
+			case len(tc.wantErr) == 0 && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case len(tc.wantErr) > 0 && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
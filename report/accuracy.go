@@ -0,0 +1,57 @@
+package report
+
+import (
+	"time"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+)
+
+// AccuracyError is the difference between a trend metric value calculated from
+// an approximate trend sink (e.g. "dds") and the exact one, as observed in the
+// accuracy self-check mode (see XK6_CUSTOSUMMARY_TRENDSINK_CHECK).
+type AccuracyError struct {
+	// Exact is the exact value.
+	Exact float64 `json:"exact"`
+
+	// Abs is the absolute difference (i.e. approximated - exact).
+	Abs float64 `json:"abs"`
+
+	// Pct is the relative difference, as a percentage of the exact value.
+	// It is zero when the exact value is zero, as it is undefined.
+	Pct float64 `json:"pct"`
+}
+
+// accuracyOf returns the AccuracyError of each of the given values, calculated from
+// the given sink, if it is checked against an exact one (see sink.TrendSink.Exact).
+// Otherwise, it returns nil.
+func accuracyOf(
+	s sink.Sink, values map[string]float64,
+	getMetricValues func(sink.Sink, time.Duration) map[string]float64, testDuration time.Duration,
+) map[string]AccuracyError {
+	typed, isTrend := s.(*sink.TrendSink)
+	if !isTrend {
+		return nil
+	}
+
+	exact, isChecked := typed.Exact()
+	if !isChecked {
+		return nil
+	}
+
+	exactValues := getMetricValues(exact, testDuration)
+	errs := make(map[string]AccuracyError, len(values))
+	for stat, value := range values {
+		exactValue, ok := exactValues[stat]
+		if !ok {
+			continue
+		}
+
+		e := AccuracyError{Exact: exactValue, Abs: value - exactValue}
+		if exactValue != 0 {
+			e.Pct = e.Abs / exactValue * 100
+		}
+		errs[stat] = e
+	}
+
+	return errs
+}
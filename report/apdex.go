@@ -0,0 +1,179 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// Apdex is the Application Performance Index of a trend metric (see Report.AddApdex),
+// that is, the share of satisfied values (lower than or equal to the target T), plus half
+// the share of tolerating values (up to 4T). The rest of the values are frustrated.
+type Apdex struct {
+	// T is the target (i.e. the threshold of the satisfied values),
+	// in the unit of the metric values (e.g. milliseconds).
+	T float64 `json:"t"`
+
+	// Score is the Apdex score, from 0 (all frustrated) to 1 (all satisfied).
+	Score float64 `json:"score"`
+
+	Satisfied  uint64 `json:"satisfied"`
+	Tolerating uint64 `json:"tolerating"`
+	Frustrated uint64 `json:"frustrated"`
+}
+
+// apdexStat is the name of the stat, in the values of a metric, that holds its
+// Apdex score, so it can be compared against a baseline and checked by tolerances.
+const apdexStat = "apdex"
+
+// Rating returns the conventional rating of the Apdex score:
+// "excellent", "good", "fair", "poor" or "unacceptable".
+func (a Apdex) Rating() string {
+	switch {
+	case a.Score >= 0.94:
+		return "excellent"
+	case a.Score >= 0.85:
+		return "good"
+	case a.Score >= 0.70:
+		return "fair"
+	case a.Score >= 0.50:
+		return "poor"
+	default:
+		return "unacceptable"
+	}
+}
+
+// ApdexTarget is the Apdex target T of a trend metric (see ParseApdexTarget).
+type ApdexTarget struct {
+	// T is in the unit of the metric values (e.g. milliseconds).
+	T float64
+
+	// IsDuration is set when T was given as a duration (e.g. "500ms"),
+	// so it only applies to time metrics (see Report.AddApdex).
+	IsDuration bool
+}
+
+// ApdexTargets holds the Apdex target of the trend metrics, by metric name.
+// The one of a metric also applies to its groups and sub-metrics
+// (e.g. `http_req_duration{scenario:api}`), unless they have their own.
+type ApdexTargets map[string]ApdexTarget
+
+// ParseApdexTargets parses a list of Apdex targets by metric, separated by semicolons,
+// in the "metric=T" form, where T is either a number, in the unit of the metric values,
+// or a duration (e.g. "http_req_duration=500ms;my_trend=200").
+func ParseApdexTargets(s string) (ApdexTargets, error) {
+	targets := make(ApdexTargets)
+	for _, raw := range strings.Split(s, ";") {
+		raw = strings.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+
+		metric, rawT, ok := strings.Cut(raw, "=")
+		metric = strings.TrimSpace(metric)
+		if !ok || len(metric) == 0 {
+			return nil, fmt.Errorf("invalid Apdex target '%s', expected the metric=T form", raw)
+		}
+
+		t, err := ParseApdexTarget(rawT)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Apdex target for the '%s' metric: %w", metric, err)
+		}
+		targets[metric] = t
+	}
+
+	return targets, nil
+}
+
+// ParseApdexTarget parses an Apdex target T, either as a positive number,
+// in the unit of the metric values, or as a duration (e.g. "500ms"), that
+// only applies to time metrics (see Report.AddApdex).
+func ParseApdexTarget(s string) (ApdexTarget, error) {
+	s = strings.TrimSpace(s)
+
+	t, isDuration, ok := parseTrendValue(s)
+	if !ok || t <= 0 || math.IsInf(t, 0) {
+		return ApdexTarget{}, fmt.Errorf("invalid T '%s', provide a positive number or duration (e.g. 500ms)", s)
+	}
+
+	return ApdexTarget{T: t, IsDuration: isDuration}, nil
+}
+
+// AddApdex sets the Apdex of each trend metric in the report (including groups and
+// sub-metrics) that has a target defined in the given ApdexTargets, from the values in the
+// given collection. Its score is also set as the "apdex" value of the metric, so it must be
+// called before Report.Compare. They are approximated if so are the metric values.
+//
+// It returns an error if any target given as a duration applies to a trend metric
+// whose values aren't durations (see ParseApdexTarget), as its T would be meaningless.
+func (r Report) AddApdex(c timeseries.Collection, targets ApdexTargets) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	for name, metric := range r.Metrics {
+		if metric.Type != metrics.Trend {
+			continue
+		}
+
+		t, ok := targets[name]
+		if !ok {
+			base, _, _ := strings.Cut(name, "{")
+			if t, ok = targets[base]; !ok {
+				continue
+			}
+		}
+
+		if t.IsDuration && metric.Contains != metrics.Time {
+			return fmt.Errorf("invalid Apdex target for the '%s' metric, "+
+				"its values aren't durations, provide a number instead", name)
+		}
+
+		ts := getForMetric(c, name)
+		if ts == nil {
+			continue
+		}
+
+		typed, isTrend := ts.Sink.(*sink.TrendSink)
+		if !isTrend {
+			continue
+		}
+
+		apdex := apdexOf(typed, t.T)
+		metric.Apdex = &apdex
+		metric.Values[apdexStat] = apdex.Score
+		r.Metrics[name] = metric
+	}
+
+	return nil
+}
+
+// apdexOf returns the Apdex of the values in the given sink, with the given target T.
+func apdexOf(s *sink.TrendSink, t float64) Apdex {
+	apdex := Apdex{T: t}
+
+	count := s.Count()
+	if count == 0 {
+		return apdex
+	}
+
+	// Ranks are the fraction of values lower than or equal to the given
+	// one, so the tolerating values are the ones between both ranks.
+	satisfied := uint64(math.Round(s.Rank(t) * float64(count)))
+	notFrustrated := uint64(math.Round(s.Rank(4*t) * float64(count)))
+	if notFrustrated < satisfied {
+		notFrustrated = satisfied
+	}
+
+	apdex.Satisfied = satisfied
+	apdex.Tolerating = notFrustrated - satisfied
+	apdex.Frustrated = count - notFrustrated
+	apdex.Score = (float64(apdex.Satisfied) + float64(apdex.Tolerating)/2) / float64(count)
+
+	return apdex
+}
@@ -0,0 +1,199 @@
+package report
+
+import (
+	"math"
+	"testing"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func TestParseApdexTarget(t *testing.T) {
+	t.Parallel()
+
+	for raw, want := range map[string]ApdexTarget{
+		"200":    {T: 200},
+		" 0.5 ":  {T: 0.5},
+		"500ms":  {T: 500, IsDuration: true},
+		"1.5s":   {T: 1500, IsDuration: true},
+		"250µs":  {T: 0.25, IsDuration: true},
+		"1m30s":  {T: 90_000, IsDuration: true},
+		"1e3":    {T: 1000},
+		"0.01ms": {T: 0.01, IsDuration: true},
+	} {
+		got, err := ParseApdexTarget(raw)
+		if err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+		if math.Abs(got.T-want.T) > 1e-9 || got.IsDuration != want.IsDuration {
+			t.Errorf("%q: expected %+v, got %+v", raw, want, got)
+		}
+	}
+
+	for _, invalid := range []string{"", "abc", "0", "-200", "0ms", "-1s", "NaN", "+Inf"} {
+		if _, err := ParseApdexTarget(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestParseApdexTargets(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseApdexTargets(" http_req_duration = 500ms ; my_trend=200;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ApdexTargets{
+		"http_req_duration": {T: 500, IsDuration: true},
+		"my_trend":          {T: 200},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for metric, target := range want {
+		if got[metric] != target {
+			t.Errorf("%s: expected %+v, got %+v", metric, target, got[metric])
+		}
+	}
+
+	for _, invalid := range []string{"http_req_duration", "=500ms", "http_req_duration=", "http_req_duration=abc"} {
+		if _, err := ParseApdexTargets(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestApdexOf(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name   string
+		values []float64
+		want   Apdex
+		rating string
+	}{
+		{
+			// Up to T (100) are satisfied, and up to 4T (400) tolerating, both inclusive.
+			name:   "all zones",
+			values: []float64{50, 100, 150, 400, 401, 1000},
+			want:   Apdex{T: 100, Score: 0.5, Satisfied: 2, Tolerating: 2, Frustrated: 2},
+			rating: "poor",
+		},
+		{
+			name:   "all satisfied",
+			values: []float64{10, 20, 100},
+			want:   Apdex{T: 100, Score: 1, Satisfied: 3},
+			rating: "excellent",
+		},
+		{
+			name:   "all tolerating",
+			values: []float64{101, 400},
+			want:   Apdex{T: 100, Score: 0.5, Tolerating: 2},
+			rating: "poor",
+		},
+		{
+			name:   "all frustrated",
+			values: []float64{500, 1000},
+			want:   Apdex{T: 100, Score: 0, Frustrated: 2},
+			rating: "unacceptable",
+		},
+		{
+			name:   "empty",
+			want:   Apdex{T: 100},
+			rating: "unacceptable",
+		},
+	} {
+		got := apdexOf(newTrendSink(tc.values...), 100)
+		if got != tc.want {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.want, got)
+		}
+		if rating := got.Rating(); rating != tc.rating {
+			t.Errorf("%s: expected rating %q, got %q", tc.name, tc.rating, rating)
+		}
+	}
+}
+
+func TestApdexRating(t *testing.T) {
+	t.Parallel()
+
+	for score, want := range map[float64]string{
+		1: "excellent", 0.94: "excellent",
+		0.93: "good", 0.85: "good",
+		0.84: "fair", 0.70: "fair",
+		0.69: "poor", 0.50: "poor",
+		0.49: "unacceptable", 0: "unacceptable",
+	} {
+		if got := (Apdex{Score: score}).Rating(); got != want {
+			t.Errorf("%v: expected %q, got %q", score, want, got)
+		}
+	}
+}
+
+func TestAddApdex(t *testing.T) {
+	t.Parallel()
+
+	timeMeta := timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time}
+	dataMeta := timeseries.Meta{Type: metrics.Trend, Contains: metrics.Data}
+
+	c := timeseries.NewCollection()
+	for key, ts := range map[timeseries.Key]timeseries.TimeSeries{
+		timeseries.NewKeyFromTags("http_req_duration", map[string]string{"scenario": "api"}): {
+			Meta: timeMeta, Sink: newTrendSink(50, 100, 150, 400),
+		},
+		timeseries.NewKeyFromTags("http_req_duration", map[string]string{"scenario": "web"}): {
+			Meta: timeMeta, Sink: newTrendSink(401, 1000),
+		},
+		timeseries.NewKeyFromTags("data_trend", nil): {
+			Meta: dataMeta, Sink: newTrendSink(1024, 4096),
+		},
+	} {
+		ts.Key = key
+		c[key] = ts
+	}
+
+	newReport := func() Report {
+		return Report{Metrics: map[string]Metric{
+			"http_req_duration":               {Meta: timeMeta, Values: Values{"avg": 350}},
+			"http_req_duration{scenario:api}": {Meta: timeMeta, Values: Values{"avg": 175}},
+			"http_req_duration{scenario:web}": {Meta: timeMeta, Values: Values{"avg": 700}},
+			"data_trend":                      {Meta: dataMeta, Values: Values{"avg": 2560}},
+		}}
+	}
+
+	r := newReport()
+	err := r.AddApdex(c, ApdexTargets{
+		"http_req_duration":               {T: 100, IsDuration: true},
+		"http_req_duration{scenario:web}": {T: 1000, IsDuration: true},
+		"data_trend":                      {T: 2048},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]Apdex{
+		"http_req_duration":               {T: 100, Score: 0.5, Satisfied: 2, Tolerating: 2, Frustrated: 2},
+		"http_req_duration{scenario:api}": {T: 100, Score: 0.75, Satisfied: 2, Tolerating: 2},
+		// Groups with their own target don't use the one of their metric.
+		"http_req_duration{scenario:web}": {T: 1000, Score: 1, Satisfied: 2},
+		"data_trend":                      {T: 2048, Score: 0.75, Satisfied: 1, Tolerating: 1},
+	} {
+		metric := r.Metrics[name]
+		if metric.Apdex == nil || *metric.Apdex != want {
+			t.Errorf("%s: expected %+v, got %+v", name, want, metric.Apdex)
+			continue
+		}
+		// The score is also a value, to be compared against a baseline.
+		if got := metric.Values[apdexStat]; got != want.Score {
+			t.Errorf("%s: expected the %q value to be %v, got %v", name, apdexStat, want.Score, got)
+		}
+	}
+
+	// Targets given as a duration don't apply to metrics whose values aren't durations.
+	r = newReport()
+	if err := r.AddApdex(c, ApdexTargets{"data_trend": {T: 2048, IsDuration: true}}); err == nil {
+		t.Fatal("expected an error for a duration target on a data trend")
+	}
+}
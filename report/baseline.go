@@ -0,0 +1,141 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+// Delta is the difference between a metric value and
+// the same value in a baseline report (e.g. a previous run).
+type Delta struct {
+	// Baseline is the value in the baseline report.
+	Baseline float64 `json:"baseline"`
+
+	// Abs is the absolute difference (i.e. value - baseline).
+	Abs float64 `json:"abs"`
+
+	// Pct is the relative difference, as a percentage of the baseline.
+	// It is zero when the baseline is zero, as it is undefined.
+	Pct float64 `json:"pct"`
+
+	// Verdict tells whether the difference is an improvement or not.
+	Verdict Verdict `json:"verdict"`
+}
+
+// Verdict tells whether a Delta is an improvement or not,
+// depending on the metric type and the stat.
+type Verdict string
+
+const (
+	// VerdictBetter means the value is better than the baseline.
+	VerdictBetter Verdict = "better"
+
+	// VerdictWorse means the value is worse than the baseline.
+	VerdictWorse Verdict = "worse"
+
+	// VerdictNeutral means the value is equal to the baseline,
+	// or that the difference is neither good nor bad (e.g. for gauges).
+	VerdictNeutral Verdict = "neutral"
+)
+
+// Compare sets the Deltas of each metric in the report, against the values of the
+// same metric (by name) in the given baseline report. The values that aren't present
+// in the baseline report are skipped.
+//
+// The differences of the values whose confidence interval (see Report.AddConfidenceIntervals)
+// contains the baseline value are neutral, as they might be just noise (e.g. on short runs).
+func (r Report) Compare(baseline Report) {
+	for name, metric := range r.Metrics {
+		baseMetric, ok := baseline.Metrics[name]
+		if !ok || baseMetric.Type != metric.Type {
+			continue
+		}
+
+		deltas := make(map[string]Delta, len(metric.Values))
+		for stat, value := range metric.Values {
+			// There's no meaningful difference for non-finite values
+			// (e.g. the avg of an empty trend), so they are skipped too.
+			baseValue, ok := baseMetric.Values[stat]
+			if !ok || !isFinite(value) || !isFinite(baseValue) {
+				continue
+			}
+
+			d := Delta{Baseline: baseValue, Abs: value - baseValue, Verdict: VerdictNeutral}
+			if baseValue != 0 {
+				d.Pct = d.Abs / baseValue * 100
+			}
+			if interval, ok := metric.Intervals[stat]; ok && interval.Contains(baseValue) {
+				d.Verdict = VerdictNeutral
+			} else if d.Abs != 0 {
+				d.Verdict = verdictFor(name, metric, stat, d.Abs)
+			}
+			deltas[stat] = d
+		}
+
+		metric.Deltas = deltas
+		r.Metrics[name] = metric
+	}
+}
+
+// verdictFor returns the Verdict for the given (non-zero) difference of the
+// given stat, depending on whether higher values are better for the metric.
+func verdictFor(name string, metric Metric, stat string, diff float64) Verdict {
+	var higherIsBetter bool
+
+	switch metric.Type {
+	case metrics.Trend:
+		// Lower is better for all trend stats (e.g. latencies), but the count
+		// and the sum, that grow with the number of values.
+		if stat == "count" || stat == "sum" {
+			return VerdictNeutral
+		}
+		// But for the percentile ranks (e.g. "pr(200ms)"), the share of values
+		// lower than or equal to the given one, and the Apdex score, where higher is better.
+		higherIsBetter = strings.HasPrefix(stat, "pr(") || stat == apdexStat
+	case metrics.Counter:
+		// Data counters (e.g. data_sent) are neither good nor bad.
+		if metric.Contains == metrics.Data {
+			return VerdictNeutral
+		}
+		higherIsBetter = !isFailureMetric(name)
+	case metrics.Rate:
+		if stat != "rate" {
+			return VerdictNeutral
+		}
+		higherIsBetter = !isFailureMetric(name)
+	default:
+		return VerdictNeutral
+	}
+
+	if (diff > 0) == higherIsBetter {
+		return VerdictBetter
+	}
+	return VerdictWorse
+}
+
+// isFinite returns whether the given value is neither NaN nor infinite.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// isFailureMetric returns whether the metric, by name, counts failures
+// (e.g. http_req_failed), so the lower its values are, the better.
+func isFailureMetric(name string) bool {
+	name, _, _ = strings.Cut(name, "{")
+	return strings.Contains(name, "fail") || strings.Contains(name, "error")
+}
+
+// ReadJSON decodes a Report previously encoded as JSON (e.g. by the HTTP server,
+// or by the `custosummary render -format json` command) from the given io.Reader.
+func ReadJSON(r io.Reader) (Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return Report{}, fmt.Errorf("malformed report: %w", err)
+	}
+	return report, nil
+}
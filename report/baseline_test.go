@@ -0,0 +1,123 @@
+package report
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	metric := func(typ metrics.MetricType, contains metrics.ValueType, values Values) Metric {
+		return Metric{Meta: timeseries.Meta{Type: typ, Contains: contains}, Values: values}
+	}
+
+	current := Report{Metrics: map[string]Metric{
+		"http_req_duration": metric(metrics.Trend, metrics.Time, Values{"avg": 120, "p(95)": 80, "count": 10, "max": 50}),
+		"http_reqs":         metric(metrics.Counter, metrics.Default, Values{"count": 90, "rate": 9}),
+		"http_req_failed":   metric(metrics.Rate, metrics.Default, Values{"rate": 0.2, "passes": 2}),
+		"checks":            metric(metrics.Rate, metrics.Default, Values{"rate": 0.8}),
+		"data_sent":         metric(metrics.Counter, metrics.Data, Values{"count": 200}),
+		"vus":               metric(metrics.Gauge, metrics.Default, Values{"value": 20}),
+		"empty_trend":       metric(metrics.Trend, metrics.Time, Values{"avg": math.NaN(), "count": 0}),
+		"new_metric":        metric(metrics.Counter, metrics.Default, Values{"count": 1}),
+		"retyped":           metric(metrics.Gauge, metrics.Default, Values{"value": 1}),
+	}}
+
+	baseline := Report{Metrics: map[string]Metric{
+		"http_req_duration": metric(metrics.Trend, metrics.Time, Values{"avg": 100, "p(95)": 100, "count": 5, "max": 50}),
+		"http_reqs":         metric(metrics.Counter, metrics.Default, Values{"count": 100}),
+		"http_req_failed":   metric(metrics.Rate, metrics.Default, Values{"rate": 0.1, "passes": 1}),
+		"checks":            metric(metrics.Rate, metrics.Default, Values{"rate": 0}),
+		"data_sent":         metric(metrics.Counter, metrics.Data, Values{"count": 100}),
+		"vus":               metric(metrics.Gauge, metrics.Default, Values{"value": 10}),
+		"empty_trend":       metric(metrics.Trend, metrics.Time, Values{"avg": 10, "count": 0}),
+		"retyped":           metric(metrics.Counter, metrics.Default, Values{"count": 1}),
+		"gone_metric":       metric(metrics.Counter, metrics.Default, Values{"count": 1}),
+	}}
+
+	current.Compare(baseline)
+
+	expected := map[string]map[string]Delta{
+		"http_req_duration": {
+			"avg":   {Baseline: 100, Abs: 20, Pct: 20, Verdict: VerdictWorse},
+			"p(95)": {Baseline: 100, Abs: -20, Pct: -20, Verdict: VerdictBetter},
+			"count": {Baseline: 5, Abs: 5, Pct: 100, Verdict: VerdictNeutral},
+			"max":   {Baseline: 50, Abs: 0, Pct: 0, Verdict: VerdictNeutral},
+		},
+		"http_reqs": {
+			// The rate isn't present in the baseline, so it is skipped.
+			"count": {Baseline: 100, Abs: -10, Pct: -10, Verdict: VerdictWorse},
+		},
+		"http_req_failed": {
+			"rate":   {Baseline: 0.1, Abs: 0.1, Pct: 100, Verdict: VerdictWorse},
+			"passes": {Baseline: 1, Abs: 1, Pct: 100, Verdict: VerdictNeutral},
+		},
+		"checks": {
+			// The relative difference is undefined for a zero baseline.
+			"rate": {Baseline: 0, Abs: 0.8, Pct: 0, Verdict: VerdictBetter},
+		},
+		"data_sent": {
+			"count": {Baseline: 100, Abs: 100, Pct: 100, Verdict: VerdictNeutral},
+		},
+		"vus": {
+			"value": {Baseline: 10, Abs: 10, Pct: 100, Verdict: VerdictNeutral},
+		},
+		"empty_trend": {
+			// The NaN avg is skipped, as there's no meaningful difference.
+			"count": {Baseline: 0, Abs: 0, Pct: 0, Verdict: VerdictNeutral},
+		},
+		// Metrics missing in the baseline, or with another type, have no deltas.
+		"new_metric": nil,
+		"retyped":    nil,
+	}
+
+	if len(current.Metrics) != len(expected) {
+		t.Fatalf("expected %d metrics, got %d", len(expected), len(current.Metrics))
+	}
+
+	for name, deltas := range expected {
+		got := current.Metrics[name].Deltas
+		for stat, d := range got {
+			// Rounded, to avoid floating-point noise (e.g. 0.2 - 0.1).
+			d.Abs = math.Round(d.Abs*1e9) / 1e9
+			d.Pct = math.Round(d.Pct*1e9) / 1e9
+			got[stat] = d
+		}
+		if !reflect.DeepEqual(got, deltas) {
+			t.Errorf("%s: expected deltas %v, got %v", name, deltas, got)
+		}
+	}
+
+	if _, ok := current.Metrics["gone_metric"]; ok {
+		t.Error("expected metrics only present in the baseline to be ignored")
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	t.Parallel()
+
+	r, err := ReadJSON(strings.NewReader(
+		`{"metrics":{"http_reqs":{"type":"counter","contains":"default","values":{"count":10,"rate":"NaN"}}}}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := r.Metrics["http_reqs"]
+	if m.Type != metrics.Counter || m.Values["count"] != 10 || !math.IsNaN(m.Values["rate"]) {
+		t.Fatalf("unexpected metric: %+v", m)
+	}
+
+	for _, input := range []string{``, `{"metrics":`, `{"metrics":{"x":{"type":"unknown"}}}`} {
+		if _, err := ReadJSON(strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// Interval is the confidence interval of a metric value (see Report.AddConfidenceIntervals).
+type Interval struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// Contains returns whether the given value is within the interval.
+func (i Interval) Contains(value float64) bool {
+	return value >= i.Lower && value <= i.Upper
+}
+
+// ParseConfidenceLevel parses a confidence level, either as a fraction
+// (e.g. "0.95") or as a percentage (e.g. "95%"), within the (0, 1) range.
+func ParseConfidenceLevel(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	raw, isPct := strings.CutSuffix(s, "%")
+	level, err := strconv.ParseFloat(raw, 64)
+	if isPct {
+		level /= 100
+	}
+
+	if err != nil || !(level > 0 && level < 1) {
+		return 0, fmt.Errorf("invalid confidence level '%s', provide a number between 0 and 1 (exclusive), e.g. 0.95", s)
+	}
+
+	return level, nil
+}
+
+// AddConfidenceIntervals sets the Intervals of each metric in the report (including groups
+// and sub-metrics), with the given confidence level (e.g. 0.95), from the values in the given
+// collection. That is, the rate of rate metrics (Wilson score interval), and the percentiles
+// of trend metrics (e.g. "med", "p(95)"), only if they are exact (see sink.TrendSink.PInterval).
+//
+// It must be called before Report.Compare, so the differences against the baseline within
+// the confidence interval (i.e. that may be just noise) are considered neutral.
+func (r Report) AddConfidenceIntervals(c timeseries.Collection, level float64) {
+	for name, metric := range r.Metrics {
+		if metric.Type != metrics.Rate && metric.Type != metrics.Trend {
+			continue
+		}
+
+		ts := getForMetric(c, name)
+		if ts == nil {
+			continue
+		}
+
+		intervals := make(map[string]Interval)
+		switch typed := ts.Sink.(type) {
+		case *sink.RateSink:
+			if typed.Total > 0 {
+				lower, upper := wilsonInterval(typed.Trues, typed.Total, level)
+				intervals["rate"] = Interval{Lower: lower, Upper: upper}
+			}
+		case *sink.TrendSink:
+			for stat := range metric.Values {
+				pct, isPercentile := percentileOf(stat)
+				if !isPercentile {
+					continue
+				}
+				if lower, upper, ok := typed.PInterval(pct, level); ok {
+					intervals[stat] = Interval{Lower: lower, Upper: upper}
+				}
+			}
+		}
+
+		if len(intervals) > 0 {
+			metric.Intervals = intervals
+			r.Metrics[name] = metric
+		}
+	}
+}
+
+// percentileOf returns the percentile, within the [0, 1] range,
+// of the given trend stat, if it is one (i.e. "med" or "p(N)").
+func percentileOf(stat string) (float64, bool) {
+	if stat == "med" {
+		return 0.5, true
+	}
+
+	percentile, err := parsePercentile(stat)
+	if err != nil {
+		return 0, false
+	}
+
+	return percentile / 100, true
+}
+
+// wilsonInterval returns the Wilson score interval of the rate of the given number of
+// successes (trues) out of the given total, for the given confidence level (e.g. 0.95).
+// Unlike the normal approximation, it stays within [0, 1], and it is reliable for
+// small totals, or rates close to 0 or 1 (e.g. error rates). Without any total,
+// the rate is unknown, so the interval is the whole range.
+func wilsonInterval(trues, total int64, level float64) (lower, upper float64) {
+	if total == 0 {
+		return 0, 1
+	}
+
+	n := float64(total)
+	p := float64(trues) / n
+	z := math.Sqrt2 * math.Erfinv(level)
+
+	denominator := 1 + z*z/n
+	center := (p + z*z/(2*n)) / denominator
+	margin := z / denominator * math.Sqrt(p*(1-p)/n+z*z/(4*n*n))
+
+	return math.Max(center-margin, 0), math.Min(center+margin, 1)
+}
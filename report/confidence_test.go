@@ -0,0 +1,202 @@
+package report
+
+import (
+	"math"
+	"testing"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func TestParseConfidenceLevel(t *testing.T) {
+	t.Parallel()
+
+	for raw, want := range map[string]float64{"0.95": 0.95, " 0.9 ": 0.9, "99%": 0.99, "50%": 0.5} {
+		got, err := ParseConfidenceLevel(raw)
+		if err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+		if math.Abs(got-want) > 1e-12 {
+			t.Errorf("%q: expected %v, got %v", raw, want, got)
+		}
+	}
+
+	for _, invalid := range []string{"", "abc", "0", "1", "100%", "-0.5", "95"} {
+		if _, err := ParseConfidenceLevel(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestWilsonInterval(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name         string
+		trues, total int64
+		level        float64
+		lower, upper float64
+	}{
+		{name: "half", trues: 50, total: 100, level: 0.95, lower: 0.403832, upper: 0.596168},
+		{name: "low rate", trues: 1, total: 10, level: 0.95, lower: 0.017876, upper: 0.404150},
+		{name: "higher level", trues: 50, total: 100, level: 0.99, lower: 0.375280, upper: 0.624720},
+		// Unlike the normal approximation, it's not empty for rates of 0 or 1.
+		{name: "zero rate", trues: 0, total: 10, level: 0.95, lower: 0, upper: 0.277533},
+		{name: "full rate", trues: 10, total: 10, level: 0.95, lower: 0.722467, upper: 1},
+		{name: "no total", trues: 0, total: 0, level: 0.95, lower: 0, upper: 1},
+	} {
+		lower, upper := wilsonInterval(tc.trues, tc.total, tc.level)
+		if math.Abs(lower-tc.lower) > 1e-6 || math.Abs(upper-tc.upper) > 1e-6 {
+			t.Errorf("%s: expected [%v, %v], got [%v, %v]", tc.name, tc.lower, tc.upper, lower, upper)
+		}
+	}
+}
+
+func TestPercentileInterval(t *testing.T) {
+	t.Parallel()
+
+	// The values from 1 to 100, so each value is also its rank.
+	values := make([]float64, 0, 100)
+	for i := 1; i <= 100; i++ {
+		values = append(values, float64(i))
+	}
+
+	// The same values, split into sorted runs, as merged from sorted sinks (see trend.MergeAll).
+	runs := make([]trend.Sink, 0, 4)
+	for i := 0; i < 4; i++ {
+		s := trend.NewK6Sink()
+		for j := i; j < len(values); j += 4 {
+			s.Add(metrics.Sample{Value: values[j]})
+		}
+		s.Sort()
+		runs = append(runs, s)
+	}
+	merged, err := trend.MergeAll(runs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		pct, level   float64
+		lower, upper float64
+	}{
+		// The ranks are 50 ± 1.96 * sqrt(100 * 0.5 * 0.5), rounded outwards.
+		{name: "median", pct: 0.5, level: 0.95, lower: 40, upper: 60},
+		// The ranks are 95 ± 1.96 * sqrt(100 * 0.95 * 0.05), rounded outwards.
+		{name: "p(95)", pct: 0.95, level: 0.95, lower: 90, upper: 100},
+		{name: "higher level", pct: 0.5, level: 0.99, lower: 37, upper: 63},
+		// There's no uncertainty about the min and the max.
+		{name: "p(0)", pct: 0, level: 0.95, lower: 1, upper: 1},
+		{name: "p(100)", pct: 1, level: 0.95, lower: 100, upper: 100},
+	} {
+		for name, s := range map[string]trend.Sink{"values": newTrendSink(values...).Sink, "runs": merged} {
+			lower, upper, ok := (&sink.TrendSink{Sink: s}).PInterval(tc.pct, tc.level)
+			if !ok {
+				t.Fatalf("%s (%s): expected an interval", tc.name, name)
+			}
+			if lower != tc.lower || upper != tc.upper {
+				t.Errorf("%s (%s): expected [%v, %v], got [%v, %v]", tc.name, name, tc.lower, tc.upper, lower, upper)
+			}
+		}
+	}
+
+	// Empty sinks have an empty interval.
+	if lower, upper, ok := newTrendSink().PInterval(0.5, 0.95); !ok || lower != 0 || upper != 0 {
+		t.Errorf("empty: expected [0, 0], got [%v, %v] (ok=%t)", lower, upper, ok)
+	}
+
+	// Approximated sinks have none, as their values aren't the order statistics.
+	approximated := &sink.TrendSink{Sink: trend.NewDDSketchHistogramSink()}
+	approximated.Add(metrics.Sample{Value: 1})
+	if _, _, ok := approximated.PInterval(0.5, 0.95); ok {
+		t.Error("approximated: expected no interval")
+	}
+}
+
+func TestAddConfidenceIntervals(t *testing.T) {
+	t.Parallel()
+
+	trendMeta := timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time}
+	rateMeta := timeseries.Meta{Type: metrics.Rate, Contains: metrics.Default}
+
+	values := make([]float64, 0, 100)
+	for i := 1; i <= 100; i++ {
+		values = append(values, float64(i))
+	}
+
+	rate := &sink.RateSink{RateSink: &metrics.RateSink{}}
+	for i := 0; i < 100; i++ {
+		rate.Add(metrics.Sample{Value: float64(i % 2)})
+	}
+
+	c := timeseries.NewCollection()
+	for name, ts := range map[string]timeseries.TimeSeries{
+		"http_req_duration": {Meta: trendMeta, Sink: newTrendSink(values...)},
+		"http_req_failed":   {Meta: rateMeta, Sink: rate},
+		"empty_rate":        {Meta: rateMeta, Sink: &sink.RateSink{RateSink: &metrics.RateSink{}}},
+	} {
+		ts.Key = timeseries.NewKeyFromTags(name, nil)
+		c[ts.Key] = ts
+	}
+
+	r := Report{Metrics: map[string]Metric{
+		"http_req_duration": {Meta: trendMeta, Values: Values{"avg": 50.5, "med": 50.5, "p(95)": 95}},
+		"http_req_failed":   {Meta: rateMeta, Values: Values{"rate": 0.5}},
+		"empty_rate":        {Meta: rateMeta, Values: Values{"rate": 0}},
+	}}
+	r.AddConfidenceIntervals(c, 0.95)
+
+	want := map[string]map[string]Interval{
+		// Only the percentiles have intervals, not the rest of stats (e.g. the average).
+		"http_req_duration": {"med": {Lower: 40, Upper: 60}, "p(95)": {Lower: 90, Upper: 100}},
+		"http_req_failed":   {"rate": {Lower: 0.403832, Upper: 0.596168}},
+		"empty_rate":        nil,
+	}
+	for name, intervals := range want {
+		got := r.Metrics[name].Intervals
+		if len(got) != len(intervals) {
+			t.Fatalf("%s: expected %v, got %v", name, intervals, got)
+		}
+		for stat, interval := range intervals {
+			if math.Abs(got[stat].Lower-interval.Lower) > 1e-6 || math.Abs(got[stat].Upper-interval.Upper) > 1e-6 {
+				t.Errorf("%s %s: expected %v, got %v", name, stat, interval, got[stat])
+			}
+		}
+	}
+}
+
+func TestCompareWithinInterval(t *testing.T) {
+	t.Parallel()
+
+	meta := timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time}
+	current := Report{Metrics: map[string]Metric{
+		"http_req_duration": {
+			Meta:      meta,
+			Values:    Values{"avg": 120, "med": 110, "p(95)": 200},
+			Intervals: map[string]Interval{"med": {Lower: 90, Upper: 130}, "p(95)": {Lower: 180, Upper: 220}},
+		},
+	}}
+	baseline := Report{Metrics: map[string]Metric{
+		"http_req_duration": {Meta: meta, Values: Values{"avg": 100, "med": 100, "p(95)": 150}},
+	}}
+
+	current.Compare(baseline)
+
+	deltas := current.Metrics["http_req_duration"].Deltas
+	for stat, want := range map[string]Verdict{
+		// The baseline median is within its interval, so the change may be just noise.
+		"med": VerdictNeutral,
+		// The baseline p(95) is out of its interval, so the change is significant.
+		"p(95)": VerdictWorse,
+		// The average has no interval, so any change is significant.
+		"avg": VerdictWorse,
+	} {
+		if got := deltas[stat].Verdict; got != want {
+			t.Errorf("%s: expected verdict %v, got %v", stat, want, got)
+		}
+	}
+}
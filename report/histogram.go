@@ -0,0 +1,246 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// Histogram is the distribution of the values of a trend metric,
+// in explicit buckets (see Report.AddHistograms).
+type Histogram struct {
+	// Bounds are the upper bounds (inclusive) of the buckets, in ascending order.
+	// There's an additional bucket, for the values greater than the last one.
+	Bounds []float64 `json:"bounds"`
+
+	// Counts are the number of values in each bucket,
+	// so there's one more than there are Bounds.
+	Counts []uint64 `json:"counts"`
+
+	// Cumulative are the percentages of values lower than or equal to the upper
+	// bound of each bucket, so the last one (without upper bound) is always 100.
+	Cumulative []float64 `json:"cumulative"`
+}
+
+// Buckets holds the upper bounds of the histogram buckets of the trend metrics,
+// by metric name. The ones of a metric also apply to its groups and sub-metrics
+// (e.g. `http_req_duration{scenario:api}`), unless they have their own.
+type Buckets map[string][]float64
+
+// ParseBuckets parses a list of bucket bounds by metric, separated by semicolons,
+// in the "metric=bound,bound,..." form (e.g. "http_req_duration=50,100,250,500,1000").
+func ParseBuckets(s string) (Buckets, error) {
+	buckets := make(Buckets)
+	for _, raw := range strings.Split(s, ";") {
+		raw = strings.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+
+		metric, rawBounds, ok := strings.Cut(raw, "=")
+		metric = strings.TrimSpace(metric)
+		if !ok || len(metric) == 0 {
+			return nil, fmt.Errorf("invalid buckets '%s', expected the metric=bound,bound,... form", raw)
+		}
+
+		var bounds []float64
+		for _, rawBound := range strings.Split(rawBounds, ",") {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(rawBound), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bucket bound '%s' for the '%s' metric", rawBound, metric)
+			}
+			bounds = append(bounds, bound)
+		}
+
+		if err := ValidateBounds(bounds); err != nil {
+			return nil, fmt.Errorf("invalid buckets for the '%s' metric: %w", metric, err)
+		}
+		buckets[metric] = bounds
+	}
+
+	return buckets, nil
+}
+
+// ValidateBounds checks if the given bucket bounds are valid for use in a Histogram,
+// that is, at least one, finite and in strictly ascending order.
+func ValidateBounds(bounds []float64) error {
+	if len(bounds) == 0 {
+		return fmt.Errorf("at least one bucket bound is required")
+	}
+
+	for i, bound := range bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("bucket bound %g is not a finite number", bound)
+		}
+		if i > 0 && bound <= bounds[i-1] {
+			return fmt.Errorf("bucket bounds must be in strictly ascending order, but %g comes after %g", bound, bounds[i-1])
+		}
+	}
+
+	return nil
+}
+
+// AddHistograms sets the Histogram of each trend metric in the report (including
+// groups and sub-metrics) that has bucket bounds defined in the given Buckets, from
+// the values in the given collection. They are approximated if so are the metric values.
+func (r Report) AddHistograms(c timeseries.Collection, buckets Buckets) {
+	if len(buckets) == 0 {
+		return
+	}
+
+	for name, metric := range r.Metrics {
+		if metric.Type != metrics.Trend {
+			continue
+		}
+
+		bounds, ok := buckets[name]
+		if !ok {
+			base, _, _ := strings.Cut(name, "{")
+			if bounds, ok = buckets[base]; !ok {
+				continue
+			}
+		}
+
+		ts := getForMetric(c, name)
+		if ts == nil {
+			continue
+		}
+
+		typed, isTrend := ts.Sink.(*sink.TrendSink)
+		if !isTrend {
+			continue
+		}
+
+		metric.Histogram = histogramOf(typed, bounds)
+		r.Metrics[name] = metric
+	}
+}
+
+// getForMetric returns the time series of the given report metric name, which
+// is either a metric, a sub-metric, or a group (e.g. `http_req_duration{scenario:api}`,
+// see Report.AddGroups), from the given collection. It returns nil if there is none.
+//
+// The time series of the metrics in the report have already been merged successfully
+// to build it (see From and Report.AddGroups), so they're expected to be mergeable.
+// Otherwise, they're treated as missing.
+func getForMetric(c timeseries.Collection, name string) *timeseries.TimeSeries {
+	// Sub-metrics are stored as metrics on their own.
+	if ts, err := c.Get(timeseries.NewKeyFromTags(name, nil)); ts != nil || err != nil {
+		return ts
+	}
+
+	base, rawTag, isGroup := strings.Cut(name, "{")
+	if !isGroup {
+		return nil
+	}
+
+	tag, value, ok := strings.Cut(strings.TrimSuffix(rawTag, "}"), ":")
+	if !ok {
+		return nil
+	}
+
+	ts, _ := c.Get(timeseries.NewKeyFromTags(base, map[string]string{tag: value}))
+	return ts
+}
+
+// histogramOf returns the Histogram of the values in the given sink, with the given bucket bounds.
+func histogramOf(s *sink.TrendSink, bounds []float64) *Histogram {
+	h := &Histogram{
+		Bounds:     bounds,
+		Counts:     make([]uint64, len(bounds)+1),
+		Cumulative: make([]float64, len(bounds)+1),
+	}
+
+	count := s.Count()
+	if count == 0 {
+		return h
+	}
+
+	var under uint64
+	for i, bound := range bounds {
+		// The rank is the fraction of values lower than or equal
+		// to the bound, so the number of values in all the buckets
+		// up to this one, that can only grow.
+		cumulative := uint64(math.Round(s.Rank(bound) * float64(count)))
+		if cumulative < under {
+			cumulative = under
+		}
+
+		h.Counts[i] = cumulative - under
+		h.Cumulative[i] = float64(cumulative) / float64(count) * 100
+		under = cumulative
+	}
+	h.Counts[len(bounds)] = count - under
+	h.Cumulative[len(bounds)] = 100
+
+	return h
+}
+
+// distributionBuckets is the number of buckets of the distributions (see Report.AddDistributions).
+const distributionBuckets = 10
+
+// AddDistributions sets the Distribution of each trend metric in the report (including groups
+// and sub-metrics) selected by the given function, from the values in the given collection.
+//
+// Its buckets are log-scaled, from the min to the max value of the metric, so both the fast and
+// the slow values get enough resolution, and modes that are far apart (e.g. cache hits and misses)
+// are visible. Metrics with a single value, or without positive values, have no distribution.
+func (r Report) AddDistributions(c timeseries.Collection, selected func(name string) bool) {
+	for name, metric := range r.Metrics {
+		if metric.Type != metrics.Trend {
+			continue
+		}
+
+		base, _, _ := strings.Cut(name, "{")
+		if !selected(name) && !selected(base) {
+			continue
+		}
+
+		ts := getForMetric(c, name)
+		if ts == nil {
+			continue
+		}
+
+		typed, isTrend := ts.Sink.(*sink.TrendSink)
+		if !isTrend {
+			continue
+		}
+
+		bounds := logScaledBounds(typed.Min(), typed.Max(), distributionBuckets)
+		if len(bounds) == 0 {
+			continue
+		}
+
+		metric.Distribution = histogramOf(typed, bounds)
+		r.Metrics[name] = metric
+	}
+}
+
+// logScaledBounds returns the upper bounds of the given number of buckets, log-scaled
+// between the given min and max values, excluding the last one (i.e. the max), as
+// expected by Histogram. For non-positive min values, the buckets start three orders
+// of magnitude below the max value. It returns nil if there's no range to split.
+func logScaledBounds(min, max float64, buckets int) []float64 {
+	if max <= 0 || min >= max {
+		return nil
+	}
+
+	lowest := min
+	if lowest <= 0 {
+		lowest = max / 1000
+	}
+
+	ratio := math.Pow(max/lowest, 1/float64(buckets))
+	bounds := make([]float64, 0, buckets-1)
+	for i := 1; i < buckets; i++ {
+		bounds = append(bounds, lowest*math.Pow(ratio, float64(i)))
+	}
+
+	return bounds
+}
@@ -0,0 +1,277 @@
+package report
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func TestParseBuckets(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseBuckets(" http_req_duration = 50, 100,250 ; my_trend=0.5;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Buckets{
+		"http_req_duration": {50, 100, 250},
+		"my_trend":          {0.5},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for _, invalid := range []string{
+		"http_req_duration",
+		"=50,100",
+		"http_req_duration=50,abc",
+		"http_req_duration=",
+		"http_req_duration=100,50",
+	} {
+		if _, err := ParseBuckets(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestValidateBounds(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		bounds  []float64
+		wantErr bool
+	}{
+		{name: "single", bounds: []float64{100}},
+		{name: "ascending", bounds: []float64{-10, 0, 0.5, 100}},
+		{name: "empty", bounds: nil, wantErr: true},
+		{name: "descending", bounds: []float64{100, 50}, wantErr: true},
+		{name: "repeated", bounds: []float64{50, 50}, wantErr: true},
+		{name: "nan", bounds: []float64{50, math.NaN()}, wantErr: true},
+		{name: "infinite", bounds: []float64{50, math.Inf(1)}, wantErr: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := ValidateBounds(tc.bounds); tc.wantErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHistogramOf(t *testing.T) {
+	t.Parallel()
+
+	bounds := []float64{2.5, 5, 7}
+
+	// The bounds are inclusive, so 5 goes into the second bucket, and the
+	// values greater than the last bound (8, 9 and 10) into the last one.
+	h := histogramOf(newTrendSink(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), bounds)
+	if want := []uint64{2, 3, 2, 3}; !reflect.DeepEqual(want, h.Counts) {
+		t.Errorf("counts: expected %v, got %v", want, h.Counts)
+	}
+	if want := []float64{20, 50, 70, 100}; !reflect.DeepEqual(want, h.Cumulative) {
+		t.Errorf("cumulative: expected %v, got %v", want, h.Cumulative)
+	}
+
+	// All the values can fall into the last bucket.
+	h = histogramOf(newTrendSink(100, 200), bounds)
+	if want := []uint64{0, 0, 0, 2}; !reflect.DeepEqual(want, h.Counts) {
+		t.Errorf("counts: expected %v, got %v", want, h.Counts)
+	}
+
+	// Empty sinks have empty buckets, and no cumulative percentages.
+	h = histogramOf(newTrendSink(), bounds)
+	if want := []uint64{0, 0, 0, 0}; !reflect.DeepEqual(want, h.Counts) {
+		t.Errorf("counts: expected %v, got %v", want, h.Counts)
+	}
+	if want := []float64{0, 0, 0, 0}; !reflect.DeepEqual(want, h.Cumulative) {
+		t.Errorf("cumulative: expected %v, got %v", want, h.Cumulative)
+	}
+}
+
+func TestHistogramOfApproximated(t *testing.T) {
+	t.Parallel()
+
+	s := &sink.TrendSink{Sink: trend.NewDDSketchHistogramSink()}
+	for i := 1; i <= 1000; i++ {
+		s.Add(metrics.Sample{Value: float64(i)})
+	}
+
+	h := histogramOf(s, []float64{100, 250, 500, 750})
+
+	// The counts are approximated, but they still add up to the total.
+	var total uint64
+	for i, want := range []float64{100, 150, 250, 250, 250} {
+		total += h.Counts[i]
+		if got := float64(h.Counts[i]); math.Abs(got-want) > want*0.05 {
+			t.Errorf("bucket %d: expected about %v values, got %v", i, want, got)
+		}
+	}
+	if total != 1000 {
+		t.Errorf("expected the counts to add up to 1000, got %d", total)
+	}
+	if last := h.Cumulative[len(h.Cumulative)-1]; last != 100 {
+		t.Errorf("expected the last cumulative percentage to be 100, got %v", last)
+	}
+}
+
+func TestAddHistograms(t *testing.T) {
+	t.Parallel()
+
+	trendMeta := timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time}
+	counterMeta := timeseries.Meta{Type: metrics.Counter, Contains: metrics.Default}
+
+	c := timeseries.NewCollection()
+	add := func(key timeseries.Key, meta timeseries.Meta, s sink.Sink) {
+		c[key] = timeseries.TimeSeries{Key: key, Meta: meta, Sink: s}
+	}
+	add(timeseries.NewKeyFromTags("http_req_duration", map[string]string{"scenario": "api"}),
+		trendMeta, newTrendSink(10, 20, 30))
+	add(timeseries.NewKeyFromTags("http_req_duration", map[string]string{"scenario": "web"}),
+		trendMeta, newTrendSink(300))
+	add(timeseries.NewKeyFromTags("http_reqs", nil), counterMeta, sink.New(metrics.Counter))
+
+	r := Report{Metrics: map[string]Metric{
+		"http_req_duration":                 {Meta: trendMeta},
+		"http_req_duration{scenario:api}":   {Meta: trendMeta},
+		"http_req_duration{scenario:web}":   {Meta: trendMeta},
+		"http_req_duration{scenario:other}": {Meta: trendMeta},
+		"http_reqs":                         {Meta: counterMeta},
+	}}
+	r.AddHistograms(c, Buckets{
+		"http_req_duration":               {25, 100},
+		"http_req_duration{scenario:web}": {500},
+		"http_reqs":                       {1},
+	})
+
+	for name, want := range map[string][]uint64{
+		"http_req_duration":               {2, 1, 1},
+		"http_req_duration{scenario:api}": {2, 1, 0},
+		// Groups with their own buckets don't use the ones of their metric.
+		"http_req_duration{scenario:web}": {1, 0},
+	} {
+		h := r.Metrics[name].Histogram
+		if h == nil {
+			t.Errorf("%s: expected a histogram", name)
+			continue
+		}
+		if !reflect.DeepEqual(want, h.Counts) {
+			t.Errorf("%s: expected %v, got %v", name, want, h.Counts)
+		}
+	}
+
+	// Neither the groups without time series, nor the non-trend metrics, have histograms.
+	for _, name := range []string{"http_req_duration{scenario:other}", "http_reqs"} {
+		if h := r.Metrics[name].Histogram; h != nil {
+			t.Errorf("%s: expected no histogram, got %v", name, h)
+		}
+	}
+}
+
+func TestLogScaledBounds(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		min, max float64
+		buckets  int
+		want     []float64
+	}{
+		{name: "positive", min: 1, max: 1000, buckets: 3, want: []float64{10, 100}},
+		{name: "single bucket", min: 1, max: 1000, buckets: 1, want: []float64{}},
+		// Without a positive min, the buckets start three orders of magnitude below the max.
+		{name: "zero min", min: 0, max: 1000, buckets: 3, want: []float64{10, 100}},
+		{name: "negative min", min: -5, max: 1000, buckets: 3, want: []float64{10, 100}},
+		{name: "no range", min: 5, max: 5, buckets: 3},
+		{name: "no positive values", min: -10, max: 0, buckets: 3},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := logScaledBounds(tc.min, tc.max, tc.buckets)
+			if tc.want == nil {
+				if got != nil {
+					t.Fatalf("expected no bounds, got %v", got)
+				}
+				return
+			}
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tc.want[i]) > 1e-9 {
+					t.Fatalf("expected %v, got %v", tc.want, got)
+				}
+			}
+			// They're always valid bounds, for a Histogram.
+			if err := ValidateBounds(got); len(got) > 0 && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestAddDistributions(t *testing.T) {
+	t.Parallel()
+
+	trendMeta := timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time}
+
+	values := make([]float64, 0, 1000)
+	for i := 1; i <= 1000; i++ {
+		values = append(values, float64(i))
+	}
+
+	c := timeseries.NewCollection()
+	api := timeseries.NewKeyFromTags("http_req_duration", map[string]string{"scenario": "api"})
+	single := timeseries.NewKeyFromTags("single_trend", nil)
+	c[api] = timeseries.TimeSeries{Key: api, Meta: trendMeta, Sink: newTrendSink(values...)}
+	c[single] = timeseries.TimeSeries{Key: single, Meta: trendMeta, Sink: newTrendSink(42)}
+
+	r := Report{Metrics: map[string]Metric{
+		"http_req_duration":               {Meta: trendMeta},
+		"http_req_duration{scenario:api}": {Meta: trendMeta},
+		"single_trend":                    {Meta: trendMeta},
+	}}
+	r.AddDistributions(c, func(name string) bool { return name == "http_req_duration" || name == "single_trend" })
+
+	// The groups of the selected metrics are selected too.
+	for _, name := range []string{"http_req_duration", "http_req_duration{scenario:api}"} {
+		d := r.Metrics[name].Distribution
+		if d == nil {
+			t.Fatalf("%s: expected a distribution", name)
+		}
+		if len(d.Counts) != distributionBuckets {
+			t.Fatalf("%s: expected %d buckets, got %d", name, distributionBuckets, len(d.Counts))
+		}
+
+		// The buckets are log-scaled, from the min (1) to the max (1000), so each one is
+		// twice as wide (i.e. 10^(3/10)) as the previous one, and has about twice the values.
+		var total uint64
+		for i, count := range d.Counts {
+			total += count
+			if i > 1 && (float64(count) < float64(d.Counts[i-1])*1.5 || float64(count) > float64(d.Counts[i-1])*2.5) {
+				t.Errorf("%s: expected about twice the values in bucket %d than in the previous one, got %v", name, i, d.Counts)
+			}
+		}
+		if total != 1000 {
+			t.Errorf("%s: expected the counts to add up to 1000, got %d", name, total)
+		}
+	}
+
+	// There's no range to split with a single value.
+	if d := r.Metrics["single_trend"].Distribution; d != nil {
+		t.Errorf("single_trend: expected no distribution, got %v", d)
+	}
+}
@@ -0,0 +1,73 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Values holds the values of a report.Metric, by stat name (e.g. "p(95)").
+//
+// It is encoded as a regular JSON object, except for the non-finite
+// values (e.g. the avg of an empty trend), which aren't valid JSON
+// numbers, so they are encoded as the "NaN", "+Inf" and "-Inf" strings,
+// as in the Prometheus text exposition format (see prometheusValue).
+type Values map[string]float64
+
+// MarshalJSON implements json.Marshaler.
+func (v Values) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+
+	encoded := make(map[string]any, len(v))
+	for stat, value := range v {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			encoded[stat] = prometheusValue(value)
+			continue
+		}
+		encoded[stat] = value
+	}
+
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	if decoded == nil {
+		*v = nil
+		return nil
+	}
+
+	values := make(Values, len(decoded))
+	for stat, value := range decoded {
+		switch typed := value.(type) {
+		case float64:
+			values[stat] = typed
+		case string:
+			parsed, ok := nonFiniteValues[typed]
+			if !ok {
+				return fmt.Errorf("invalid value '%s' for the '%s' stat", typed, stat)
+			}
+			values[stat] = parsed
+		default:
+			return fmt.Errorf("invalid value '%v' for the '%s' stat", value, stat)
+		}
+	}
+
+	*v = values
+	return nil
+}
+
+// nonFiniteValues holds the non-finite values that can be
+// present in the JSON encoding of Values, by their encoding.
+var nonFiniteValues = map[string]float64{
+	"NaN":  math.NaN(),
+	"+Inf": math.Inf(1),
+	"-Inf": math.Inf(-1),
+}
@@ -0,0 +1,50 @@
+package report
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestValuesJSON(t *testing.T) {
+	t.Parallel()
+
+	values := Values{
+		"avg":   math.NaN(),
+		"max":   math.Inf(1),
+		"min":   math.Inf(-1),
+		"count": 3,
+	}
+
+	encoded, err := json.Marshal(Report{Metrics: map[string]Metric{"trend": {Values: values}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const expected = `{"metrics":{"trend":{"type":"counter","contains":"default",` +
+		`"values":{"avg":"NaN","count":3,"max":"+Inf","min":"-Inf"}}}}`
+	if string(encoded) != expected {
+		t.Fatalf("expected %s, got %s", expected, encoded)
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := decoded.Metrics["trend"].Values
+	if !math.IsNaN(got["avg"]) || !math.IsInf(got["max"], 1) || !math.IsInf(got["min"], -1) || got["count"] != 3 {
+		t.Fatalf("unexpected decoded values: %v", got)
+	}
+}
+
+func TestValuesJSONInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{`{"avg":"fast"}`, `{"avg":true}`, `[1]`} {
+		var values Values
+		if err := json.Unmarshal([]byte(input), &values); err == nil {
+			t.Errorf("expected an error for %s, got %v", input, values)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// WritePrometheus writes the report to the given io.Writer in the Prometheus text
+// exposition format, with one gauge per metric and stat (e.g. `k6_http_req_duration{stat="p(95)"}`).
+// The histograms (see Report.AddHistograms) are written as gauges too, with the cumulative
+// count of each bucket, like Prometheus histograms (e.g. `k6_http_req_duration_bucket{le="100"}`),
+// and so are the counts of each Apdex zone (e.g. `k6_http_req_duration_apdex{zone="satisfied"}`),
+// besides the Apdex score, as the "apdex" stat (see Report.AddApdex).
+//
+// Sub-metrics (e.g. `http_req_duration{scenario:api}`) are written as the same metric,
+// but with their tags as additional labels.
+func (r Report) WritePrometheus(w io.Writer) error {
+	names := make([]string, 0, len(r.Metrics))
+	for name := range r.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Lines are grouped by family (i.e. Prometheus metric name), as
+	// the report names don't sort the same way (e.g. `foo_x` goes
+	// before `foo{tag:v}`), but the families cannot be split.
+	families := make(prometheusFamilies)
+	for _, name := range names {
+		metric := r.Metrics[name]
+		promName, labels := prometheusNameAndLabels(name)
+
+		stats := make([]string, 0, len(metric.Values))
+		for stat := range metric.Values {
+			stats = append(stats, stat)
+		}
+		sort.Strings(stats)
+
+		for _, stat := range stats {
+			families.add(promName, fmt.Sprintf("%s{%sstat=%q} %s",
+				promName, labels, stat, prometheusValue(metric.Values[stat]),
+			))
+		}
+	}
+
+	// The histograms and Apdex zones may belong to the family of another metric
+	// (e.g. the `foo` ones go to `foo_bucket`, the family of the `foo_bucket` metric).
+	r.addPrometheusHistograms(families, names)
+	r.addPrometheusApdex(families, names)
+
+	return families.writeTo(w)
+}
+
+// prometheusFamilies holds the lines (i.e. samples) of each
+// metric family, by name, to be written together (see writeTo).
+type prometheusFamilies map[string][]string
+
+// add adds the given line to the given family.
+func (f prometheusFamilies) add(family, line string) {
+	f[family] = append(f[family], line)
+}
+
+// writeTo writes the families, sorted by name, each one
+// preceded by its type, into the given io.Writer.
+func (f prometheusFamilies) writeTo(w io.Writer) error {
+	families := make([]string, 0, len(f))
+	for family := range f {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+
+	for _, family := range families {
+		if _, err := fmt.Fprintf(w, "# TYPE %s gauge\n", family); err != nil {
+			return err
+		}
+		for _, line := range f[family] {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// addPrometheusHistograms adds the histograms of the given metrics,
+// if any, to the given families, as expected by WritePrometheus.
+func (r Report) addPrometheusHistograms(families prometheusFamilies, names []string) {
+	for _, name := range names {
+		h := r.Metrics[name].Histogram
+		if h == nil {
+			continue
+		}
+
+		promName, labels := prometheusNameAndLabels(name)
+		promName += "_bucket"
+
+		var cumulative uint64
+		for i, count := range h.Counts {
+			cumulative += count
+
+			le := math.Inf(1)
+			if i < len(h.Bounds) {
+				le = h.Bounds[i]
+			}
+
+			families.add(promName, fmt.Sprintf("%s{%sle=%q} %d", promName, labels, prometheusValue(le), cumulative))
+		}
+	}
+}
+
+// addPrometheusApdex adds the counts of each Apdex zone of the given
+// metrics, if any, to the given families, as expected by WritePrometheus.
+func (r Report) addPrometheusApdex(families prometheusFamilies, names []string) {
+	for _, name := range names {
+		a := r.Metrics[name].Apdex
+		if a == nil {
+			continue
+		}
+
+		promName, labels := prometheusNameAndLabels(name)
+		promName += "_apdex"
+
+		zones := []struct {
+			name  string
+			count uint64
+		}{
+			{"satisfied", a.Satisfied},
+			{"tolerating", a.Tolerating},
+			{"frustrated", a.Frustrated},
+		}
+		for _, zone := range zones {
+			families.add(promName, fmt.Sprintf("%s{%szone=%q} %d", promName, labels, zone.name, zone.count))
+		}
+	}
+}
+
+// prometheusNameAndLabels returns the Prometheus metric name, and the labels
+// (in the `key="value",` form) for the given report metric name.
+func prometheusNameAndLabels(name string) (string, string) {
+	var labels strings.Builder
+
+	name, rawTags, hasTags := strings.Cut(name, "{")
+	if hasTags {
+		for _, pair := range strings.Split(strings.TrimSuffix(rawTags, "}"), ",") {
+			k, v, found := strings.Cut(pair, ":")
+			if !found {
+				continue
+			}
+			labels.WriteString(fmt.Sprintf("%s=%q,", sanitizePrometheusName(k), v))
+		}
+	}
+
+	return "k6_" + sanitizePrometheusName(name), labels.String()
+}
+
+// sanitizePrometheusName replaces any character not allowed
+// in Prometheus metric and label names with an underscore.
+func sanitizePrometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(name))
+}
+
+// prometheusValue formats the given value as expected by the
+// Prometheus text exposition format, including special values.
+func prometheusValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return fmt.Sprintf("%g", v)
+	}
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+	"strings"
+	"testing"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func TestWritePrometheusHistograms(t *testing.T) {
+	t.Parallel()
+
+	trendMeta := timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time}
+	histogram := &Histogram{Bounds: []float64{100, 500}, Counts: []uint64{2, 1, 1}}
+
+	r := Report{Metrics: map[string]Metric{
+		"http_req_duration":               {Meta: trendMeta, Values: Values{"avg": 150}, Histogram: histogram},
+		"http_req_duration{scenario:api}": {Meta: trendMeta, Values: Values{"avg": 50}, Histogram: histogram},
+		// A metric whose family is the one of the histograms above.
+		"http_req_duration_bucket": {Meta: trendMeta, Values: Values{"avg": 1}},
+	}}
+
+	var sb strings.Builder
+	if err := r.WritePrometheus(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	// The buckets are cumulative, and the samples of each family are written together.
+	want := strings.Join([]string{
+		`# TYPE k6_http_req_duration gauge`,
+		`k6_http_req_duration{stat="avg"} 150`,
+		`k6_http_req_duration{scenario="api",stat="avg"} 50`,
+		`# TYPE k6_http_req_duration_bucket gauge`,
+		`k6_http_req_duration_bucket{stat="avg"} 1`,
+		`k6_http_req_duration_bucket{le="100"} 2`,
+		`k6_http_req_duration_bucket{le="500"} 3`,
+		`k6_http_req_duration_bucket{le="+Inf"} 4`,
+		`k6_http_req_duration_bucket{scenario="api",le="100"} 2`,
+		`k6_http_req_duration_bucket{scenario="api",le="500"} 3`,
+		`k6_http_req_duration_bucket{scenario="api",le="+Inf"} 4`,
+		``,
+	}, "\n")
+	if got := sb.String(); got != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestWritePrometheusApdex(t *testing.T) {
+	t.Parallel()
+
+	trendMeta := timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time}
+	apdex := &Apdex{T: 100, Score: 0.5, Satisfied: 2, Tolerating: 2, Frustrated: 2}
+
+	r := Report{Metrics: map[string]Metric{
+		"http_req_duration{scenario:api}": {Meta: trendMeta, Values: Values{"apdex": 0.5}, Apdex: apdex},
+	}}
+
+	var sb strings.Builder
+	if err := r.WritePrometheus(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		`# TYPE k6_http_req_duration gauge`,
+		`k6_http_req_duration{scenario="api",stat="apdex"} 0.5`,
+		`# TYPE k6_http_req_duration_apdex gauge`,
+		`k6_http_req_duration_apdex{scenario="api",zone="satisfied"} 2`,
+		`k6_http_req_duration_apdex{scenario="api",zone="tolerating"} 2`,
+		`k6_http_req_duration_apdex{scenario="api",zone="frustrated"} 2`,
+		``,
+	}, "\n")
+	if got := sb.String(); got != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
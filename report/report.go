@@ -2,11 +2,13 @@ package report
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
 
 	"go.k6.io/k6/lib"
+	"go.k6.io/k6/metrics"
 
 	"github.com/joanlopez/xk6-custosummary/sink"
 	"github.com/joanlopez/xk6-custosummary/timeseries"
@@ -15,7 +17,11 @@ import (
 // Report holds the source data to build a human-readable summary (see the `summary` package).
 // It is mainly composed by a map of metrics, where the key is the metric name.
 type Report struct {
-	Metrics map[string]Metric
+	Metrics map[string]Metric `json:"metrics"`
+
+	// Breaches holds the tolerances against the baseline that have not been
+	// satisfied, if any (see Report.CheckTolerances).
+	Breaches []Breach `json:"breaches,omitempty"`
 }
 
 // From creates a Report from a timeseries.Collection.
@@ -26,10 +32,14 @@ type Report struct {
 //
 // In the future, we might want to define a default behavior that also uses
 // certain tags, and make it configure, so the user can choose.
+//
+// It returns an error if the time series of any metric cannot be merged
+// (see timeseries.Collection.Get), or if any of the trend stats doesn't apply
+// to a trend metric (see validateTrendStatsFor).
 func From(
 	c timeseries.Collection,
 	testDuration time.Duration, opts lib.Options,
-) Report {
+) (Report, error) {
 	r := Report{Metrics: make(map[string]Metric)}
 	getMetricValues := metricValueGetter(opts.SummaryTrendStats)
 
@@ -45,20 +55,170 @@ func From(
 		// a Sink that has been filled with all the samples for the metric,
 		// despite the tags.
 		seen[ts.Key.MetricName()] = struct{}{}
+		if err := validateTrendStatsFor(opts.SummaryTrendStats, metricName, ts.Meta); err != nil {
+			return Report{}, err
+		}
+		merged, err := c.Get(ts.Key.MetricNameKey())
+		if err != nil {
+			return Report{}, err
+		}
+		values := getMetricValues(merged.Sink, testDuration)
 		r.Metrics[metricName] = Metric{
-			Meta:   ts.Meta,
-			Values: getMetricValues(c.Get(ts.Key.MetricNameKey()).Sink, testDuration),
+			Meta:         ts.Meta,
+			Values:       values,
+			Approximated: isApproximated(merged.Sink),
+			Accuracy:     accuracyOf(merged.Sink, values, getMetricValues, testDuration),
 		}
 	}
 
-	return r
+	return r, nil
+}
+
+// AddGroups adds a report.Metric to the report for each combination of metric name and
+// value of the given tag present in the collection. They are named like k6 sub-metrics
+// (e.g. `http_req_duration{scenario:api}`), so they are displayed as such in the summary.
+// It returns an error if the time series of any group cannot be merged, or if any
+// of the trend stats doesn't apply to a trend metric (see From).
+func (r Report) AddGroups(
+	c timeseries.Collection, tag string,
+	testDuration time.Duration, opts lib.Options,
+) error {
+	getMetricValues := metricValueGetter(opts.SummaryTrendStats)
+
+	// We only want to add a report.Metric for each unique pair of metric name and tag value.
+	seen := make(map[string]struct{})
+	for _, ts := range c {
+		// Sub-metrics (e.g. `http_req_duration{scenario:api}`) are already a group.
+		if strings.Contains(ts.Key.MetricName(), "{") {
+			continue
+		}
+
+		value, hasTag := ts.Key.Tags()[tag]
+		if !hasTag {
+			continue
+		}
+
+		name := ts.Key.MetricName() + "{" + tag + ":" + value + "}"
+		if _, ok := seen[name]; ok {
+			continue
+		}
+
+		seen[name] = struct{}{}
+		if err := validateTrendStatsFor(opts.SummaryTrendStats, name, ts.Meta); err != nil {
+			return err
+		}
+		key := timeseries.NewKeyFromTags(ts.Key.MetricName(), map[string]string{tag: value})
+		merged, err := c.Get(key)
+		if err != nil {
+			return err
+		}
+		values := getMetricValues(merged.Sink, testDuration)
+		r.Metrics[name] = Metric{
+			Meta:         ts.Meta,
+			Values:       values,
+			Approximated: isApproximated(merged.Sink),
+			Accuracy:     accuracyOf(merged.Sink, values, getMetricValues, testDuration),
+		}
+	}
+
+	return nil
+}
+
+// ValidateTrendStats checks if the given trend stats (e.g. "avg", "p(95)")
+// are valid for use in the report, as metricValueGetter expects.
+func ValidateTrendStats(trendStats []string) error {
+	_, err := getResolversForTrendColumns(trendStats)
+	return err
+}
+
+// validateTrendStatsFor checks if the given trend stats, already validated (see
+// ValidateTrendStats), apply to the metric with the given name and shape, if it
+// is a trend. That is, percentile ranks given as a duration (e.g. "pr(200ms)")
+// only apply to time metrics, because the values of the rest aren't durations.
+func validateTrendStatsFor(trendStats []string, name string, meta timeseries.Meta) error {
+	if meta.Type != metrics.Trend || meta.Contains == metrics.Time {
+		return nil
+	}
+
+	for _, stat := range trendStats {
+		if !strings.HasPrefix(stat, "pr(") {
+			continue
+		}
+		if _, isDuration, err := parsePercentileRank(stat); err == nil && isDuration {
+			return fmt.Errorf("invalid percentile rank trend stat '%s' for the '%s' metric, "+
+				"its values aren't durations, provide a number instead", stat, name)
+		}
+	}
+
+	return nil
 }
 
 // Metric is a metric that belongs to a report.Report.
 // So, it doesn't exactly correlate with a k6 metric, but it's a representation.
 type Metric struct {
 	timeseries.Meta
-	Values map[string]float64
+	Values Values `json:"values"`
+
+	// Deltas holds the difference of each value against a baseline,
+	// if any (see Report.Compare). Otherwise, it is nil.
+	Deltas map[string]Delta `json:"deltas,omitempty"`
+
+	// Approximated is true when the values of a trend metric have been
+	// calculated from an approximate trend sink (e.g. "dds"), or from an
+	// "adaptive" one that has already been converted into it.
+	Approximated bool `json:"approximated,omitempty"`
+
+	// Accuracy holds the error of each approximated value against the exact
+	// one, in the accuracy self-check mode (see AccuracyError). Otherwise, it is nil.
+	Accuracy map[string]AccuracyError `json:"accuracy,omitempty"`
+
+	// Histogram holds the distribution of the values of a trend metric in explicit
+	// buckets, if they are defined for it (see Report.AddHistograms). Otherwise, it is nil.
+	Histogram *Histogram `json:"histogram,omitempty"`
+
+	// Distribution holds the distribution of the values of a trend metric in
+	// log-scaled buckets, derived from its values, if it has been selected
+	// (see Report.AddDistributions). Otherwise, it is nil.
+	Distribution *Histogram `json:"distribution,omitempty"`
+
+	// Intervals holds the confidence interval of each value that supports it
+	// (e.g. percentiles, rates), if requested (see Report.AddConfidenceIntervals).
+	// Otherwise, it is nil.
+	Intervals map[string]Interval `json:"intervals,omitempty"`
+
+	// Apdex holds the Apdex of a trend metric, if there's a target defined
+	// for it (see Report.AddApdex). Otherwise, it is nil.
+	Apdex *Apdex `json:"apdex,omitempty"`
+}
+
+// isApproximated returns whether the values of the given sink are approximated.
+func isApproximated(s sink.Sink) bool {
+	typed, isTrend := s.(*sink.TrendSink)
+	return isTrend && !typed.IsExact()
+}
+
+// Stat returns the value of the given stat (e.g. "count", "rate", "p(95)")
+// for the given timeseries.TimeSeries, as it would be present in a report.Metric.
+// It returns an error if the stat is unknown for the type of sink, or if it
+// doesn't apply to the time series metric (e.g. "pr(200ms)" for a data trend).
+func Stat(ts *timeseries.TimeSeries, stat string, testDuration time.Duration) (float64, error) {
+	var trendStats []string
+	if _, isTrend := ts.Sink.(*sink.TrendSink); isTrend {
+		if _, err := getResolversForTrendColumns([]string{stat}); err != nil {
+			return 0, err
+		}
+		if err := validateTrendStatsFor([]string{stat}, ts.Key.MetricName(), ts.Meta); err != nil {
+			return 0, err
+		}
+		trendStats = []string{stat}
+	}
+
+	value, ok := metricValueGetter(trendStats)(ts.Sink, testDuration)[stat]
+	if !ok {
+		return 0, fmt.Errorf("unknown stat '%s' for metric", stat)
+	}
+
+	return value, nil
 }
 
 // metricValueGetter returns a function that can extract the values from a sink.Sink
@@ -103,12 +263,30 @@ func getResolversForTrendColumns(trendColumns []string) (map[string]func(s *sink
 		"med":   func(s *sink.TrendSink) float64 { return s.P(0.5) },
 		"max":   func(s *sink.TrendSink) float64 { return s.Max() },
 		"count": func(s *sink.TrendSink) float64 { return float64(s.Count()) },
+
+		"sum":      func(s *sink.TrendSink) float64 { return s.Avg() * float64(s.Count()) },
+		"variance": func(s *sink.TrendSink) float64 { return s.Variance() },
+		"stddev":   func(s *sink.TrendSink) float64 { return math.Sqrt(s.Variance()) },
+		"iqr":      func(s *sink.TrendSink) float64 { return s.P(0.75) - s.P(0.25) },
+		"mad":      func(s *sink.TrendSink) float64 { return s.MAD() },
+		"cv": func(s *sink.TrendSink) float64 {
+			// The coefficient of variation is undefined for a zero mean.
+			if avg := s.Avg(); avg != 0 {
+				return math.Sqrt(s.Variance()) / avg
+			}
+			return 0
+		},
 	}
 	dynamicResolver := func(percentile float64) func(s *sink.TrendSink) float64 {
 		return func(s *sink.TrendSink) float64 {
 			return s.P(percentile / 100)
 		}
 	}
+	rankResolver := func(value float64) func(s *sink.TrendSink) float64 {
+		return func(s *sink.TrendSink) float64 {
+			return s.Rank(value)
+		}
+	}
 
 	result := make(map[string]func(s *sink.TrendSink) float64, len(trendColumns))
 
@@ -118,6 +296,15 @@ func getResolversForTrendColumns(trendColumns []string) (map[string]func(s *sink
 			continue
 		}
 
+		if strings.HasPrefix(stat, "pr(") {
+			value, _, err := parsePercentileRank(stat)
+			if err != nil {
+				return nil, err
+			}
+			result[stat] = rankResolver(value)
+			continue
+		}
+
 		percentile, err := parsePercentile(stat)
 		if err != nil {
 			return nil, err
@@ -143,6 +330,40 @@ func parsePercentile(stat string) (float64, error) {
 	return percentile, nil
 }
 
+// parsePercentileRank is a helper function to parse and validate percentile rank notations
+// (e.g. "pr(200)"), that are the fraction of values lower than or equal to the given one,
+// in the unit of the metric values. For time metrics, the value can also be given as a
+// duration (e.g. "pr(200ms)", "pr(1.5s)"), as they are recorded in milliseconds, so it
+// also returns whether it was given as a duration (see validateTrendStatsFor).
+func parsePercentileRank(stat string) (value float64, isDuration bool, err error) {
+	if !strings.HasPrefix(stat, "pr(") || !strings.HasSuffix(stat, ")") {
+		return 0, false, fmt.Errorf("invalid trend stat '%s', unknown format", stat)
+	}
+
+	value, isDuration, ok := parseTrendValue(stat[3 : len(stat)-1])
+	if !ok {
+		return 0, false, fmt.Errorf("invalid percentile rank trend stat value '%s', provide a number or a duration (e.g. 200ms)", stat)
+	}
+
+	return value, isDuration, nil
+}
+
+// parseTrendValue parses a value of a trend metric, either as a number, or as a
+// duration (e.g. "200ms"), converted into milliseconds, like the values of time trends.
+// It also returns whether it was given as a duration.
+func parseTrendValue(raw string) (value float64, isDuration, ok bool) {
+	if value, err := strconv.ParseFloat(raw, 64); err == nil && !math.IsNaN(value) {
+		return value, false, true
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, false, false
+	}
+
+	return float64(d) / float64(time.Millisecond), true, true
+}
+
 // calculateCounterRate calculates the rate of a counter metric,
 // given the count and the duration of the test.
 func calculateCounterRate(count float64, duration time.Duration) float64 {
@@ -0,0 +1,157 @@
+package report
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func TestTrendResolvers(t *testing.T) {
+	t.Parallel()
+
+	// A dataset with well-known stats: a mean of 5, and a (population) variance of 4.
+	values := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+
+	for stat, want := range map[string]float64{
+		"count":    8,
+		"sum":      40,
+		"avg":      5,
+		"min":      2,
+		"max":      9,
+		"med":      4.5,
+		"variance": 4,
+		"stddev":   2,
+		"cv":       0.4,
+		// The 25th and 75th percentiles, interpolated as k6 does, are 4 and 5.5.
+		"iqr": 1.5,
+		// The absolute deviations from the median (4.5) are: 0.5 (x5), 2.5 (x2) and 4.5.
+		"mad":    0.5,
+		"p(75)":  5.5,
+		"p(100)": 9,
+		// The share of values lower than or equal to the given one.
+		"pr(1)":   0,
+		"pr(4)":   0.5,
+		"pr(4.5)": 0.5,
+		"pr(5ms)": 0.75,
+		"pr(9)":   1,
+	} {
+		resolvers, err := getResolversForTrendColumns([]string{stat})
+		if err != nil {
+			t.Fatalf("%s: %v", stat, err)
+		}
+
+		if got := resolvers[stat](newTrendSink(values...)); math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v", stat, want, got)
+		}
+	}
+}
+
+func TestTrendResolversEmpty(t *testing.T) {
+	t.Parallel()
+
+	stats := []string{"count", "sum", "avg", "variance", "stddev", "cv", "iqr", "mad"}
+	resolvers, err := getResolversForTrendColumns(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stat := range stats {
+		if got := resolvers[stat](newTrendSink()); got != 0 {
+			t.Errorf("%s: expected 0 for an empty trend, got %v", stat, got)
+		}
+	}
+
+	// The coefficient of variation is undefined for a zero mean, so it's reported as zero.
+	if got := resolvers["cv"](newTrendSink(-1, 1)); got != 0 {
+		t.Errorf("cv: expected 0 for a zero mean, got %v", got)
+	}
+}
+
+func TestValidateTrendStatsFor(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		meta    timeseries.Meta
+		stats   []string
+		wantErr bool
+	}{
+		{
+			name:  "duration percentile rank on a time trend",
+			meta:  timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time},
+			stats: []string{"avg", "pr(200ms)", "pr(1.5s)"},
+		},
+		{
+			name:  "numeric percentile rank on a non-time trend",
+			meta:  timeseries.Meta{Type: metrics.Trend, Contains: metrics.Data},
+			stats: []string{"avg", "pr(1024)"},
+		},
+		{
+			name:    "duration percentile rank on a data trend",
+			meta:    timeseries.Meta{Type: metrics.Trend, Contains: metrics.Data},
+			stats:   []string{"avg", "pr(200ms)"},
+			wantErr: true,
+		},
+		{
+			name:    "duration percentile rank on a default trend",
+			meta:    timeseries.Meta{Type: metrics.Trend, Contains: metrics.Default},
+			stats:   []string{"pr(1s)"},
+			wantErr: true,
+		},
+		{
+			name:  "duration percentile rank on a non-trend",
+			meta:  timeseries.Meta{Type: metrics.Counter, Contains: metrics.Data},
+			stats: []string{"pr(200ms)"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateTrendStatsFor(tc.stats, "my_trend", tc.meta)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", tc.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "my_trend") {
+				t.Errorf("expected the error to name the metric, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestStatRejectsDurationPercentileRankForNonTimeTrends(t *testing.T) {
+	t.Parallel()
+
+	ts := &timeseries.TimeSeries{
+		Key:  timeseries.NewKeyFromTags("data_trend", nil),
+		Meta: timeseries.Meta{Type: metrics.Trend, Contains: metrics.Data},
+		Sink: newTrendSink(100, 200, 300),
+	}
+
+	if _, err := Stat(ts, "pr(200ms)", time.Second); err == nil {
+		t.Fatal("expected an error for a duration percentile rank on a data trend")
+	}
+
+	got, err := Stat(ts, "pr(200)", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2.0 / 3; math.Abs(got-want) > 1e-9 {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func newTrendSink(values ...float64) *sink.TrendSink {
+	s := &sink.TrendSink{Sink: trend.NewK6Sink()}
+	for _, v := range values {
+		s.Add(metrics.Sample{Value: v})
+	}
+	return s
+}
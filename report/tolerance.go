@@ -0,0 +1,153 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tolerance is the maximum difference allowed for a metric value against the
+// baseline, e.g. "p(95) of http_req_duration may not grow more than 10%".
+type Tolerance struct {
+	// Metric is the metric name, as in the report (e.g. `http_req_duration{scenario:api}`).
+	Metric string `json:"metric"`
+
+	// Stat is the metric value (e.g. "p(95)", "rate").
+	Stat string `json:"stat"`
+
+	// Op is either "<=" (the difference must be lower or equal than the limit)
+	// or ">=" (the difference must be greater or equal than the limit).
+	Op string `json:"op"`
+
+	// Limit is the (signed) limit for the difference.
+	Limit float64 `json:"limit"`
+
+	// Relative defines whether the limit is relative to the baseline (as a percentage),
+	// and so compared against Delta.Pct, or absolute, and so compared against Delta.Abs.
+	Relative bool `json:"relative"`
+}
+
+// ParseTolerances parses a semicolon-separated list of tolerances, each one in the
+// `<metric>:<stat><op><limit>` form, where `op` is either `<=` or `>=`, and `limit`
+// is either an absolute difference, or a relative one if suffixed by `%`. For instance:
+//   - "http_req_duration:p(95)<=10%" => p(95) of http_req_duration may not grow more than 10%.
+//   - "checks:rate>=-0.05" => the rate of checks may not drop more than 0.05 (i.e. 5 points).
+func ParseTolerances(s string) ([]Tolerance, error) {
+	var tolerances []Tolerance
+	for _, expr := range strings.Split(s, ";") {
+		expr = strings.TrimSpace(expr)
+		if len(expr) == 0 {
+			continue
+		}
+
+		t, err := parseTolerance(expr)
+		if err != nil {
+			return nil, err
+		}
+		tolerances = append(tolerances, t)
+	}
+	return tolerances, nil
+}
+
+func parseTolerance(expr string) (Tolerance, error) {
+	var t Tolerance
+
+	opIdx := strings.Index(expr, "<=")
+	t.Op = "<="
+	if opIdx < 0 {
+		opIdx = strings.Index(expr, ">=")
+		t.Op = ">="
+	}
+	if opIdx < 0 {
+		return Tolerance{}, fmt.Errorf("invalid tolerance '%s', missing operator (<= or >=)", expr)
+	}
+
+	// The metric name can contain colons (e.g. `http_req_duration{scenario:api}`),
+	// but the stat cannot, so we split by the last one.
+	target := expr[:opIdx]
+	sepIdx := strings.LastIndex(target, ":")
+	if sepIdx <= 0 || sepIdx == len(target)-1 {
+		return Tolerance{}, fmt.Errorf("invalid tolerance '%s', expected the <metric>:<stat><op><limit> form", expr)
+	}
+	t.Metric, t.Stat = strings.TrimSpace(target[:sepIdx]), strings.TrimSpace(target[sepIdx+1:])
+
+	limit := strings.TrimSpace(expr[opIdx+len(t.Op):])
+	if strings.HasSuffix(limit, "%") {
+		t.Relative = true
+		limit = strings.TrimSuffix(limit, "%")
+	}
+
+	var err error
+	t.Limit, err = strconv.ParseFloat(limit, 64)
+	if err != nil {
+		return Tolerance{}, fmt.Errorf("invalid tolerance '%s', the limit must be a number", expr)
+	}
+
+	return t, nil
+}
+
+// String returns the tolerance in the same form ParseTolerances expects.
+func (t Tolerance) String() string {
+	limit := strconv.FormatFloat(t.Limit, 'f', -1, 64)
+	if t.Limit >= 0 {
+		limit = "+" + limit
+	}
+	if t.Relative {
+		limit += "%"
+	}
+	return t.Metric + ":" + t.Stat + t.Op + limit
+}
+
+// Breach is a Tolerance that has not been satisfied.
+type Breach struct {
+	Tolerance Tolerance `json:"tolerance"`
+	Delta     Delta     `json:"delta"`
+}
+
+// Diff returns the difference against the baseline that breached the tolerance,
+// either absolute or relative (i.e. a percentage), as defined by the tolerance.
+func (b Breach) Diff() float64 {
+	return b.Tolerance.diffOf(b.Delta)
+}
+
+// diffOf returns the difference of the given Delta to check against the tolerance,
+// either absolute or relative. As the relative difference against a zero baseline is
+// undefined (see Delta.Pct), any change from zero is considered infinite, so it doesn't
+// satisfy any relative tolerance (e.g. an error rate going from 0 to 0.5).
+func (t Tolerance) diffOf(d Delta) float64 {
+	if !t.Relative {
+		return d.Abs
+	}
+
+	if d.Baseline == 0 && d.Abs != 0 {
+		return math.Inf(int(math.Copysign(1, d.Abs)))
+	}
+	return d.Pct
+}
+
+// CheckTolerances checks the given tolerances against the deltas of the report,
+// so it is expected to be called after Report.Compare. It returns the tolerances
+// that have been breached, and the ones that couldn't be checked, because either
+// the metric or the stat are missing in the report or in the baseline.
+func (r Report) CheckTolerances(tolerances []Tolerance) (breaches []Breach, unchecked []Tolerance) {
+	for _, t := range tolerances {
+		d, ok := r.Metrics[t.Metric].Deltas[t.Stat]
+		if !ok {
+			unchecked = append(unchecked, t)
+			continue
+		}
+
+		diff := t.diffOf(d)
+		satisfied := diff <= t.Limit
+		if t.Op == ">=" {
+			satisfied = diff >= t.Limit
+		}
+
+		if !satisfied {
+			breaches = append(breaches, Breach{Tolerance: t, Delta: d})
+		}
+	}
+
+	return breaches, unchecked
+}
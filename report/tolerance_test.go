@@ -0,0 +1,119 @@
+package report
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseTolerances(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseTolerances(" http_req_duration{scenario:api}:p(95)<=10% ; checks:rate>=-0.05;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Tolerance{
+		{Metric: "http_req_duration{scenario:api}", Stat: "p(95)", Op: "<=", Limit: 10, Relative: true},
+		{Metric: "checks", Stat: "rate", Op: ">=", Limit: -0.05},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if s := got[0].String(); s != "http_req_duration{scenario:api}:p(95)<=+10%" {
+		t.Errorf("unexpected string: %s", s)
+	}
+	if s := got[1].String(); s != "checks:rate>=-0.05" {
+		t.Errorf("unexpected string: %s", s)
+	}
+
+	for _, input := range []string{
+		"checks:rate=0.1",
+		"checks<=0.1",
+		":rate<=0.1",
+		"checks:<=0.1",
+		"checks:rate<=fast",
+		"checks:rate<=%",
+	} {
+		if _, err := ParseTolerances(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestToleranceDiffOf(t *testing.T) {
+	t.Parallel()
+
+	absolute := Tolerance{Limit: 1}
+	relative := Tolerance{Limit: 1, Relative: true}
+
+	for _, tc := range []struct {
+		name      string
+		tolerance Tolerance
+		delta     Delta
+		expected  float64
+	}{
+		{name: "absolute", tolerance: absolute, delta: Delta{Baseline: 10, Abs: -2, Pct: -20}, expected: -2},
+		{name: "relative", tolerance: relative, delta: Delta{Baseline: 10, Abs: -2, Pct: -20}, expected: -20},
+		{name: "absolute from zero", tolerance: absolute, delta: Delta{Baseline: 0, Abs: 0.5}, expected: 0.5},
+		{name: "relative growth from zero", tolerance: relative, delta: Delta{Baseline: 0, Abs: 0.5}, expected: math.Inf(1)},
+		{name: "relative drop from zero", tolerance: relative, delta: Delta{Baseline: 0, Abs: -0.5}, expected: math.Inf(-1)},
+		{name: "relative unchanged zero", tolerance: relative, delta: Delta{Baseline: 0}, expected: 0},
+	} {
+		if got := tc.tolerance.diffOf(tc.delta); got != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestCheckTolerances(t *testing.T) {
+	t.Parallel()
+
+	r := Report{Metrics: map[string]Metric{
+		"http_req_duration": {Deltas: map[string]Delta{
+			"p(95)": {Baseline: 100, Abs: 20, Pct: 20},
+			"avg":   {Baseline: 100, Abs: 5, Pct: 5},
+		}},
+		"http_req_failed": {Deltas: map[string]Delta{
+			"rate": {Baseline: 0, Abs: 0.01},
+		}},
+		"checks": {Deltas: map[string]Delta{
+			"rate": {Baseline: 0.9, Abs: -0.1, Pct: -11.1},
+		}},
+	}}
+
+	tolerances, err := ParseTolerances("" +
+		"http_req_duration:p(95)<=10%;" + // breached: +20%
+		"http_req_duration:avg<=10%;" + // satisfied: +5%
+		"http_req_duration:avg<=5;" + // satisfied: +5, on the limit
+		"http_req_failed:rate<=50%;" + // breached: any growth from zero
+		"http_req_failed:rate<=0.05;" + // satisfied: +0.01
+		"checks:rate>=-0.05;" + // breached: -0.1
+		"checks:count<=0;" + // unchecked: missing stat
+		"missing:rate<=0", // unchecked: missing metric
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breaches, unchecked := r.CheckTolerances(tolerances)
+
+	expectedBreaches := []Breach{
+		{Tolerance: tolerances[0], Delta: r.Metrics["http_req_duration"].Deltas["p(95)"]},
+		{Tolerance: tolerances[3], Delta: r.Metrics["http_req_failed"].Deltas["rate"]},
+		{Tolerance: tolerances[5], Delta: r.Metrics["checks"].Deltas["rate"]},
+	}
+	if !reflect.DeepEqual(breaches, expectedBreaches) {
+		t.Errorf("expected breaches %v, got %v", expectedBreaches, breaches)
+	}
+
+	if !reflect.DeepEqual(unchecked, tolerances[6:]) {
+		t.Errorf("expected unchecked %v, got %v", tolerances[6:], unchecked)
+	}
+
+	if diff := breaches[1].Diff(); !math.IsInf(diff, 1) {
+		t.Errorf("expected an infinite diff from a zero baseline, got %v", diff)
+	}
+}
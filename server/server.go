@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"go.k6.io/k6/lib"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/summary"
+)
+
+// Server is an HTTP server that exposes snapshots of the report.Report
+// while the test is running, so it can be watched from a browser or curl.
+//
+// It serves the following endpoints:
+//   - /report  => the report.Report, encoded as JSON.
+//   - /summary => the summary.Summary, rendered as plain text.
+//   - /metrics => the report.Report, in the Prometheus text exposition format.
+type Server struct {
+	srv    *http.Server
+	logger logrus.FieldLogger
+}
+
+// New initializes a new Server that listens on the given address.
+// The given snapshot function is called on every request, to get
+// the most recent report.Report. If it fails, the request fails too.
+func New(addr string, snapshot func() (report.Report, error), opts lib.Options, logger logrus.FieldLogger) *Server {
+	mux := http.NewServeMux()
+
+	// withSnapshot calls the given handler with the most recent report.Report,
+	// or responds with an internal server error if it cannot be built.
+	withSnapshot := func(handle func(http.ResponseWriter, report.Report)) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			r, err := snapshot()
+			if err != nil {
+				logger.WithError(err).Warn("Failed to build the report")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			handle(w, r)
+		}
+	}
+
+	mux.HandleFunc("/report", withSnapshot(func(w http.ResponseWriter, r report.Report) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(r); err != nil {
+			logger.WithError(err).Warn("Failed to write the report")
+		}
+	}))
+
+	mux.HandleFunc("/summary", withSnapshot(func(w http.ResponseWriter, r report.Report) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		s := summary.From(r, opts).WithoutColors()
+		if _, err := w.Write([]byte(strings.Join(s, "\n") + "\n")); err != nil {
+			logger.WithError(err).Warn("Failed to write the summary")
+		}
+	}))
+
+	mux.HandleFunc("/metrics", withSnapshot(func(w http.ResponseWriter, r report.Report) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WritePrometheus(w); err != nil {
+			logger.WithError(err).Warn("Failed to write the metrics")
+		}
+	}))
+
+	return &Server{
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		logger: logger,
+	}
+}
+
+// Start starts listening on the configured address, and serves
+// the requests in the background until Stop is called.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Debugf("Serving live report snapshots on http://%s", ln.Addr())
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.WithError(err).Error("HTTP server failed")
+		}
+	}()
+
+	return nil
+}
+
+// Stop gracefully shuts the server down, waiting for the
+// in-flight requests up to the given timeout.
+func (s *Server) Stop(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return s.srv.Shutdown(ctx)
+}
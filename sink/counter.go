@@ -1,6 +1,10 @@
 package sink
 
-import "go.k6.io/k6/metrics"
+import (
+	"fmt"
+
+	"go.k6.io/k6/metrics"
+)
 
 // We want to make sure *CounterSink implements the Sink interface.
 var _ Sink = &CounterSink{}
@@ -11,11 +15,11 @@ type CounterSink struct {
 }
 
 // Merge merges the given sink into the current one.
-// If the given sink is not a *CounterSink, it panics.
-func (c *CounterSink) Merge(s Sink) {
+// If the given sink is not a *CounterSink, it returns an error.
+func (c *CounterSink) Merge(s Sink) error {
 	toMerge, ok := s.(*CounterSink)
 	if !ok {
-		panic("trying to merge incompatible sinks")
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, c, s)
 	}
 
 	c.Value += toMerge.Value
@@ -23,4 +27,21 @@ func (c *CounterSink) Merge(s Sink) {
 		(!toMerge.First.IsZero() && toMerge.First.Before(c.First)) {
 		c.First = toMerge.First
 	}
+
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (c *CounterSink) MarshalBinary() ([]byte, error) {
+	return marshalFields(c.Value, timeToUnixNano(c.First))
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (c *CounterSink) UnmarshalBinary(data []byte) error {
+	var first int64
+	if err := unmarshalFields(data, &c.Value, &first); err != nil {
+		return err
+	}
+	c.First = unixNanoToTime(first)
+	return nil
 }
@@ -0,0 +1,52 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// marshalFields encodes the given fixed-size fields (see encoding/binary)
+// in order, as used by the MarshalBinary implementations of this package.
+func marshalFields(fields ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, field := range fields {
+		if err := binary.Write(&buf, binary.LittleEndian, field); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalFields decodes the given fixed-size fields (see encoding/binary)
+// in order, as used by the UnmarshalBinary implementations of this package.
+func unmarshalFields(data []byte, fields ...interface{}) error {
+	r := bytes.NewReader(data)
+	for _, field := range fields {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return fmt.Errorf("malformed sink data: %w", err)
+		}
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("malformed sink data: %d unexpected trailing bytes", r.Len())
+	}
+	return nil
+}
+
+// timeToUnixNano is like time.Time.UnixNano, but it
+// encodes the zero time.Time as zero, so it can be restored.
+func timeToUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// unixNanoToTime is the inverse of timeToUnixNano.
+func unixNanoToTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
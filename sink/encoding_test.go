@@ -0,0 +1,118 @@
+package sink
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+)
+
+func TestSinkRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1700000000, 0)
+	values := []float64{3, 1, 4, 1, 5, 9, 2, 6}
+
+	for _, tc := range []struct {
+		name string
+		mt   metrics.MetricType
+	}{
+		{name: "counter", mt: metrics.Counter},
+		{name: "gauge", mt: metrics.Gauge},
+		{name: "rate", mt: metrics.Rate},
+		{name: "trend", mt: metrics.Trend},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, empty := range []bool{true, false} {
+				s := New(tc.mt)
+				if !empty {
+					for i, v := range values {
+						s.Add(metrics.Sample{Value: v, Time: start.Add(time.Duration(i) * time.Second)})
+					}
+				}
+
+				got := roundTrip(t, s)
+				if got.IsEmpty() != s.IsEmpty() {
+					t.Fatalf("empty=%v: expected IsEmpty to be %v, got %v", empty, s.IsEmpty(), got.IsEmpty())
+				}
+
+				testDuration := 10 * time.Second
+				if want, have := s.Format(testDuration), got.Format(testDuration); !reflect.DeepEqual(want, have) {
+					t.Fatalf("empty=%v: expected %v, got %v", empty, want, have)
+				}
+			}
+		})
+	}
+}
+
+func TestGaugeSinkRoundTripKeepsLast(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1700000000, 0)
+
+	g := New(metrics.Gauge).(*GaugeSink)
+	g.Add(metrics.Sample{Value: 1, Time: start})
+	g.Add(metrics.Sample{Value: 2, Time: start.Add(time.Minute)})
+
+	got := roundTrip(t, g).(*GaugeSink)
+	if !got.last.Equal(g.last) {
+		t.Fatalf("expected last %v, got %v", g.last, got.last)
+	}
+
+	// The most recent value must win when merged after decoding.
+	older := New(metrics.Gauge).(*GaugeSink)
+	older.Add(metrics.Sample{Value: 3, Time: start.Add(time.Second)})
+	if err := got.Merge(older); err != nil {
+		t.Fatal(err)
+	}
+	if got.Value != 2 {
+		t.Fatalf("expected value 2, got %v", got.Value)
+	}
+}
+
+func TestTrendSinkRoundTripKeepsImplementation(t *testing.T) {
+	t.Parallel()
+
+	s := &TrendSink{Sink: trend.NewDDSketchHistogramSink()}
+	s.Add(metrics.Sample{Value: 42})
+
+	got := roundTrip(t, s).(*TrendSink)
+	if reflect.TypeOf(got.Sink) != reflect.TypeOf(s.Sink) {
+		t.Fatalf("expected a %T, got a %T", s.Sink, got.Sink)
+	}
+}
+
+// roundTrip encodes the given sink, and decodes it into a new one of the same kind.
+func roundTrip(t *testing.T, s Sink) Sink {
+	t.Helper()
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := New(metricTypeOf(s))
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	return got
+}
+
+func metricTypeOf(s Sink) metrics.MetricType {
+	switch s.(type) {
+	case *CounterSink:
+		return metrics.Counter
+	case *GaugeSink:
+		return metrics.Gauge
+	case *RateSink:
+		return metrics.Rate
+	default:
+		return metrics.Trend
+	}
+}
@@ -1,6 +1,7 @@
 package sink
 
 import (
+	"fmt"
 	"time"
 
 	"go.k6.io/k6/metrics"
@@ -25,11 +26,25 @@ func (g *GaugeSink) Add(s metrics.Sample) {
 }
 
 // Merge merges the given sink into the current one.
-// If the given sink is not a *GaugeSink, it panics.
-func (g *GaugeSink) Merge(s Sink) {
+// If the given sink is not a *GaugeSink, it returns an error.
+func (g *GaugeSink) Merge(s Sink) error {
 	toMerge, ok := s.(*GaugeSink)
 	if !ok {
-		panic("trying to merge incompatible sinks")
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, g, s)
+	}
+
+	if toMerge.IsEmpty() {
+		return nil
+	}
+
+	// If the current sink is empty, the min and max values of the
+	// given one must be taken as they are, not compared against zero.
+	if g.IsEmpty() {
+		g.GaugeSink.Add(metrics.Sample{Value: toMerge.Min})
+		g.Max = toMerge.Max
+		g.Value = toMerge.Value
+		g.last = toMerge.last
+		return nil
 	}
 
 	if toMerge.Max > g.Max {
@@ -44,4 +59,34 @@ func (g *GaugeSink) Merge(s Sink) {
 		g.last = toMerge.last
 		g.Value = toMerge.Value
 	}
+
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (g *GaugeSink) MarshalBinary() ([]byte, error) {
+	return marshalFields(g.IsEmpty(), g.Value, g.Min, g.Max, timeToUnixNano(g.last))
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (g *GaugeSink) UnmarshalBinary(data []byte) error {
+	var (
+		empty                     bool
+		value, minValue, maxValue float64
+		last                      int64
+	)
+	if err := unmarshalFields(data, &empty, &value, &minValue, &maxValue, &last); err != nil {
+		return err
+	}
+
+	g.GaugeSink = &metrics.GaugeSink{}
+	if !empty {
+		// The metrics.GaugeSink keeps track of whether it has received any value
+		// in a private field, so the only way to restore it is by adding a sample.
+		g.GaugeSink.Add(metrics.Sample{Value: minValue})
+		g.Value, g.Min, g.Max = value, minValue, maxValue
+	}
+	g.last = unixNanoToTime(last)
+
+	return nil
 }
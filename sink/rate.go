@@ -1,6 +1,10 @@
 package sink
 
-import "go.k6.io/k6/metrics"
+import (
+	"fmt"
+
+	"go.k6.io/k6/metrics"
+)
 
 // We want to make sure *RateSink implements the Sink interface.
 var _ Sink = &RateSink{}
@@ -11,13 +15,25 @@ type RateSink struct {
 }
 
 // Merge merges the given sink into the current one.
-// If the given sink is not a *RateSink, it panics.
-func (r *RateSink) Merge(s Sink) {
+// If the given sink is not a *RateSink, it returns an error.
+func (r *RateSink) Merge(s Sink) error {
 	toMerge, ok := s.(*RateSink)
 	if !ok {
-		panic("trying to merge incompatible sinks")
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, r, s)
 	}
 
 	r.Total += toMerge.Total
 	r.Trues += toMerge.Trues
+
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (r *RateSink) MarshalBinary() ([]byte, error) {
+	return marshalFields(r.Trues, r.Total)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (r *RateSink) UnmarshalBinary(data []byte) error {
+	return unmarshalFields(data, &r.Trues, &r.Total)
 }
@@ -1,7 +1,10 @@
 package sink
 
 import (
+	"encoding"
+	"errors"
 	"fmt"
+	"reflect"
 
 	"go.k6.io/k6/metrics"
 
@@ -11,12 +14,20 @@ import (
 // Sink defined the behavior expected for a sink implementation.
 // It is heavily inspired by the metrics.Sink interface, but it also
 // adds a method to merge two sinks, used to simplify the process of
-// accumulating partial results at time of building the report/summary.
+// accumulating partial results at time of building the report/summary,
+// and methods to encode and decode them, used to persist them (see
+// the snapshot package), so they can be merged or compared later.
 type Sink interface {
 	metrics.Sink
-	Merge(s Sink)
+	Merge(s Sink) error
+
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
 }
 
+// ErrIncompatibleSinks is returned when trying to merge sinks of different types.
+var ErrIncompatibleSinks = errors.New("trying to merge incompatible sinks")
+
 // New creates a new Sink based on the given metrics.MetricType.
 // It is a wrapper around metrics.NewSink, but to initialize a
 // Sink instead of a metrics.Sink.
@@ -36,3 +47,90 @@ func New(mt metrics.MetricType) Sink {
 	}
 	return sink
 }
+
+// NewFor creates a new Sink for the given metric. It is like New, but
+// the trend.Sink implementation of trend metrics is selected with the
+// given trend.SinkTypes, if any, and adjusted to the metric's value type.
+func NewFor(m *metrics.Metric, types *trend.SinkTypes) Sink {
+	switch {
+	case m.Type != metrics.Trend:
+		return New(m.Type)
+	case types != nil:
+		return &TrendSink{Sink: types.NewSink(m)}
+	default:
+		return &TrendSink{Sink: trend.NewSinkFor(m.Contains)}
+	}
+}
+
+// NewLike creates a new empty Sink of the same kind as the given one.
+// It is like New, but it also preserves the inner trend.Sink
+// implementation, in case of a *TrendSink.
+func NewLike(s Sink) Sink {
+	if typed, ok := s.(*TrendSink); ok {
+		return &TrendSink{Sink: trend.NewSinkLike(typed.Sink)}
+	}
+
+	var mt metrics.MetricType
+	switch s.(type) {
+	case *CounterSink:
+		mt = metrics.Counter
+	case *GaugeSink:
+		mt = metrics.Gauge
+	case *RateSink:
+		mt = metrics.Rate
+	}
+	return New(mt)
+}
+
+// Compatible returns an error if the given sinks cannot be merged (see Sink.Merge),
+// because they are of different kinds, or trend sinks with incompatible implementations
+// (see trend.Compatible). Unlike merging them, it neither modifies nor allocates any sink.
+func Compatible(a, b Sink) error {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, a, b)
+	}
+
+	if typed, ok := a.(*TrendSink); ok {
+		return trend.Compatible(typed.Sink, b.(*TrendSink).Sink)
+	}
+	return nil
+}
+
+// MergeAll merges all the given sinks into a new one, of the same kind.
+// It is equivalent to merging them one by one into an empty one (see NewLike),
+// but the inner trend.Sink implementations of *TrendSink are merged all at
+// once (see trend.MergeAll), which is more efficient for some of them.
+// The given sinks are not modified, but they must not be while the merged
+// one is in use, because it may share their values. It returns nil if there
+// are no sinks.
+func MergeAll(sinks ...Sink) (Sink, error) {
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	if _, ok := sinks[0].(*TrendSink); ok {
+		inner := make([]trend.Sink, 0, len(sinks))
+		for _, s := range sinks {
+			typed, ok := s.(*TrendSink)
+			if !ok {
+				return nil, fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, sinks[0], s)
+			}
+			inner = append(inner, typed.Sink)
+		}
+
+		merged, err := trend.MergeAll(inner...)
+		if err != nil {
+			return nil, err
+		}
+		return &TrendSink{Sink: merged}, nil
+	}
+
+	merged := NewLike(sinks[0])
+	for _, s := range sinks {
+		if err := merged.Merge(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
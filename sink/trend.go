@@ -1,6 +1,8 @@
 package sink
 
 import (
+	"fmt"
+
 	"github.com/joanlopez/xk6-custosummary/sink/trend"
 )
 
@@ -15,33 +17,77 @@ type TrendSink struct {
 }
 
 // Merge merges the given sink into the current one.
-// If the given sink is not a *TrendSink, it panics.
-// If inner trend.Sink implementation doesn't match, it also panics.
-func (t *TrendSink) Merge(s Sink) {
+// If the given sink is not a *TrendSink, it returns an error.
+// If inner trend.Sink implementation doesn't match, it also returns an error.
+func (t *TrendSink) Merge(s Sink) error {
 	toMerge, ok := s.(*TrendSink)
 	if !ok {
-		panic("trying to merge incompatible sinks")
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, t, s)
 	}
 
-	switch s := toMerge.Sink.(type) {
-	case *trend.K6Sink:
-		casted, ok := t.Sink.(*trend.K6Sink)
-		if !ok {
-			panic("trying to merge incompatible trend sinks")
-		}
-		casted.Merge(s)
-	case trend.DDSketchHistogramSink:
-		casted, ok := t.Sink.(trend.DDSketchHistogramSink)
-		if !ok {
-			panic("trying to merge incompatible trend sinks")
-		}
-		casted.Merge(s)
-	case trend.HdrHistogramSink:
-		casted, ok := t.Sink.(trend.HdrHistogramSink)
-		if !ok {
-			panic("trying to merge incompatible trend sinks")
-		}
-		casted.Merge(s)
+	return t.Sink.Merge(toMerge.Sink)
+}
+
+// OutOfRange returns the number of values that couldn't be recorded because
+// they are out of the range supported by the inner trend.Sink implementation.
+// It is always zero for the implementations without a limited range.
+func (t *TrendSink) OutOfRange() uint64 {
+	if ranged, ok := t.Sink.(interface{ OutOfRange() uint64 }); ok {
+		return ranged.OutOfRange()
 	}
+	return 0
+}
 
+// Sort sorts the values kept by the inner trend.Sink implementation, if any
+// (see trend.K6Sink.Sort), so merging it with others (see MergeAll) doesn't
+// require copying and sorting them. It does nothing for the rest.
+func (t *TrendSink) Sort() {
+	if sortable, ok := t.Sink.(interface{ Sort() }); ok {
+		sortable.Sort()
+	}
+}
+
+// IsExact returns whether the stats of the inner trend.Sink
+// implementation are exact, or approximated (see trend.IsExact).
+func (t *TrendSink) IsExact() bool {
+	return trend.IsExact(t.Sink)
+}
+
+// PInterval returns the confidence interval of the given percentile, for the given
+// confidence level (e.g. 0.95), if the inner trend.Sink implementation supports it,
+// which is only the case of the exact ones (see trend.K6Sink.PInterval).
+func (t *TrendSink) PInterval(pct, level float64) (lower, upper float64, ok bool) {
+	exact, ok := t.Sink.(*trend.K6Sink)
+	if !ok {
+		return 0, 0, false
+	}
+
+	lower, upper = exact.PInterval(pct, level)
+	return lower, upper, true
+}
+
+// Exact returns the exact sink kept along with the inner trend.Sink implementation,
+// in the accuracy self-check mode (see trend.CheckedSink), if any.
+func (t *TrendSink) Exact() (*TrendSink, bool) {
+	checked, ok := t.Sink.(*trend.CheckedSink)
+	if !ok {
+		return nil, false
+	}
+	return &TrendSink{Sink: checked.Exact()}, true
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+// The inner trend.Sink implementation is encoded along with it.
+func (t *TrendSink) MarshalBinary() ([]byte, error) {
+	return trend.Marshal(t.Sink)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (t *TrendSink) UnmarshalBinary(data []byte) error {
+	s, err := trend.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	t.Sink = s
+	return nil
 }
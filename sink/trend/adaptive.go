@@ -0,0 +1,259 @@
+package trend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// AdaptiveSink is a Sink implementation that starts as an exact *K6Sink,
+// and once it exceeds a given number of values, or of memory used by them,
+// converts itself into an approximate Sink (e.g. DDSketchHistogramSink),
+// so small trends stay exact, while big ones are bounded in memory.
+//
+// The limits apply to the values added into each sink (i.e. to each time series),
+// not to the ones merged into it. So, merging exact sinks (e.g. to build a report
+// with all the time series of a metric) keeps the merged one exact.
+type AdaptiveSink struct {
+	maxCount uint64
+	maxBytes uint64
+	target   SinkConfig
+
+	// Only one of them is set: exact until the sink is
+	// converted, and approx from then on.
+	exact  *K6Sink
+	approx Sink
+}
+
+// NewAdaptiveSink instantiates a new AdaptiveSink that converts itself into a Sink
+// as defined by the given target once it exceeds the given number of values or bytes.
+// A zero limit is disabled, but at least one of them must be set. The target must be
+// valid, and an approximate (bounded in memory) Sink type.
+func NewAdaptiveSink(maxCount, maxBytes uint64, target SinkConfig) (*AdaptiveSink, error) {
+	if maxCount == 0 && maxBytes == 0 {
+		return nil, fmt.Errorf("invalid adaptive trend sink limits, either the count or the memory must be set")
+	}
+
+	switch target.Type {
+	case sinkTypeK6, sinkTypeAdaptive:
+		return nil, fmt.Errorf("invalid adaptive trend sink target '%s', it must be an approximate type: %s, %s, %s, %s, %s",
+			target.Type, sinkTypeDDS, sinkTypeHdr, sinkTypeTDigest, sinkTypeReservoir, sinkTypeCircllhist)
+	}
+	if err := target.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid adaptive trend sink target: %w", err)
+	}
+
+	return &AdaptiveSink{
+		maxCount: maxCount,
+		maxBytes: maxBytes,
+		target:   target,
+		exact:    NewK6Sink(),
+	}, nil
+}
+
+// compatible returns an error if the given AdaptiveSink has different limits or
+// a different target, as the merged sink would convert itself (or not) differently
+// than any of them (see Compatible).
+func (a *AdaptiveSink) compatible(other *AdaptiveSink) error {
+	if a.maxCount != other.maxCount || a.maxBytes != other.maxBytes || a.target != other.target {
+		return fmt.Errorf("%w: adaptive trend sinks with different parameters "+
+			"(count=%d,memory=%d,to=%s and count=%d,memory=%d,to=%s)", ErrIncompatibleSinks,
+			a.maxCount, a.maxBytes, a.target, other.maxCount, other.maxBytes, other.target)
+	}
+	return nil
+}
+
+// newLike instantiates a new empty (and exact) AdaptiveSink with the same parameters.
+func (a *AdaptiveSink) newLike() *AdaptiveSink {
+	return &AdaptiveSink{
+		maxCount: a.maxCount,
+		maxBytes: a.maxBytes,
+		target:   a.target,
+		exact:    NewK6Sink(),
+	}
+}
+
+// IsExact returns whether the sink hasn't been converted into an approximate one yet.
+func (a *AdaptiveSink) IsExact() bool { return a.exact != nil }
+
+// current returns the Sink currently in use.
+func (a *AdaptiveSink) current() Sink {
+	if a.exact != nil {
+		return a.exact
+	}
+	return a.approx
+}
+
+// maybeConvert converts the sink into an approximate one,
+// if the exact one exceeds any of the limits.
+func (a *AdaptiveSink) maybeConvert() {
+	if a.exact == nil {
+		return
+	}
+
+	count := a.exact.Count()
+	if (a.maxCount == 0 || count <= a.maxCount) && (a.maxBytes == 0 || count*8 <= a.maxBytes) {
+		return
+	}
+
+	a.approx = a.target.NewSink(metrics.Default)
+	for _, v := range a.exact.values {
+		a.approx.Add(metrics.Sample{Value: v})
+	}
+	a.exact = nil
+}
+
+// IsEmpty indicates whether the TrendSink is empty.
+func (a *AdaptiveSink) IsEmpty() bool { return a.current().IsEmpty() }
+
+// Add implements the Sink interface, recording the value of the given metrics.Sample.
+func (a *AdaptiveSink) Add(s metrics.Sample) {
+	a.current().Add(s)
+	a.maybeConvert()
+}
+
+// P implements the Sink interface, returning the value at percentile.
+func (a *AdaptiveSink) P(pct float64) float64 { return a.current().P(pct) }
+
+// Min implements the Sink interface, returning the minimum value recorded.
+func (a *AdaptiveSink) Min() float64 { return a.current().Min() }
+
+// Max implements the Sink interface, returning the maximum value recorded.
+func (a *AdaptiveSink) Max() float64 { return a.current().Max() }
+
+// Count implements the Sink interface, returning the total amount of values recorded.
+func (a *AdaptiveSink) Count() uint64 { return a.current().Count() }
+
+// Avg implements the Sink interface, returning the average (mean) of values recorded.
+func (a *AdaptiveSink) Avg() float64 { return a.current().Avg() }
+
+// Variance implements the Sink interface, returning the variance of values recorded.
+func (a *AdaptiveSink) Variance() float64 { return a.current().Variance() }
+
+// MAD implements the Sink interface, returning the median absolute deviation of values recorded.
+func (a *AdaptiveSink) MAD() float64 { return a.current().MAD() }
+
+// Rank implements the Sink interface, returning the fraction
+// of values recorded lower than or equal to the given one.
+func (a *AdaptiveSink) Rank(value float64) float64 { return a.current().Rank(value) }
+
+// Format trend and return a map
+func (a *AdaptiveSink) Format(t time.Duration) map[string]float64 { return a.current().Format(t) }
+
+// Sort sorts the values of the exact sink, if it hasn't been converted yet (see K6Sink.Sort).
+func (a *AdaptiveSink) Sort() {
+	if a.exact != nil {
+		a.exact.Sort()
+	}
+}
+
+// Merge merges two Sink instances.
+// It returns an error if their limits or targets don't match.
+//
+// The merged sink is only converted into an approximate one if any of
+// them already was, no matter how many values they hold together.
+func (a *AdaptiveSink) Merge(s Sink) error {
+	toMerge, ok := s.(*AdaptiveSink)
+	if !ok {
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, a, s)
+	}
+
+	if err := a.compatible(toMerge); err != nil {
+		return err
+	}
+
+	switch {
+	case a.exact != nil && toMerge.exact != nil:
+		return a.exact.Merge(toMerge.exact)
+	case toMerge.exact != nil:
+		for _, v := range toMerge.exact.values {
+			a.approx.Add(metrics.Sample{Value: v})
+		}
+		return nil
+	default:
+		if a.exact != nil {
+			// The other one is already converted, so this one must be converted too.
+			exact := a.exact
+			a.approx, a.exact = NewSinkLike(toMerge.approx), nil
+			for _, v := range exact.values {
+				a.approx.Add(metrics.Sample{Value: v})
+			}
+		}
+		return a.approx.Merge(toMerge.approx)
+	}
+}
+
+// We want to make sure that the *AdaptiveSink
+// implements the Sink interface.
+var _ Sink = &AdaptiveSink{}
+
+// adaptiveSinkHeader is the fixed-size part of the encoded AdaptiveSink,
+// followed by its target (uvarint length + bytes), and by the Sink
+// currently in use, as encoded by Marshal.
+type adaptiveSinkHeader struct {
+	MaxCount uint64
+	MaxBytes uint64
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (a *AdaptiveSink) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	header := adaptiveSinkHeader{MaxCount: a.maxCount, MaxBytes: a.maxBytes}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+
+	target := a.target.String()
+	data := binary.AppendUvarint(buf.Bytes(), uint64(len(target)))
+	data = append(data, target...)
+
+	current, err := Marshal(a.current())
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, current...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (a *AdaptiveSink) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var header adaptiveSinkHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("malformed adaptive trend sink data: %w", err)
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil || uint64(r.Len()) < n {
+		return fmt.Errorf("malformed adaptive trend sink data: invalid target")
+	}
+	rest := data[len(data)-r.Len():]
+
+	target, err := ParseSinkConfig(string(rest[:n]))
+	if err != nil {
+		return fmt.Errorf("malformed adaptive trend sink data: %w", err)
+	}
+
+	decoded, err := NewAdaptiveSink(header.MaxCount, header.MaxBytes, target)
+	if err != nil {
+		return fmt.Errorf("malformed adaptive trend sink data: %w", err)
+	}
+
+	current, err := Unmarshal(rest[n:])
+	if err != nil {
+		return err
+	}
+
+	if exact, ok := current.(*K6Sink); ok {
+		decoded.exact = exact
+	} else {
+		decoded.approx, decoded.exact = current, nil
+	}
+
+	*a = *decoded
+	return nil
+}
@@ -0,0 +1,145 @@
+package trend
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestAdaptiveSinkConvertsOnAdd(t *testing.T) {
+	t.Parallel()
+
+	for name, limits := range map[string][2]uint64{
+		"count":  {100, 0},
+		"memory": {0, 100 * 8},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := NewAdaptiveSink(limits[0], limits[1], DefaultSinkConfig(sinkTypeDDS))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 1; i <= 100; i++ {
+				s.Add(sample(float64(i)))
+			}
+			if !s.IsExact() {
+				t.Fatal("expected the sink to be exact up to the limit")
+			}
+
+			s.Add(sample(101))
+			if s.IsExact() {
+				t.Fatal("expected the sink to be converted beyond the limit")
+			}
+			if _, ok := s.approx.(DDSketchHistogramSink); !ok {
+				t.Fatalf("expected the sink to be converted into the target, got a %T", s.approx)
+			}
+
+			// The values added before the conversion must be kept.
+			if got := s.Count(); got != 101 {
+				t.Errorf("expected 101 values, got %d", got)
+			}
+			// Up to the accuracy of the target (1%, by default).
+			if got := s.Min(); math.Abs(got-1) > 0.01 {
+				t.Errorf("expected a min of 1, got %v", got)
+			}
+		})
+	}
+}
+
+func TestAdaptiveSinkMerge(t *testing.T) {
+	t.Parallel()
+
+	newSink := func(values int) *AdaptiveSink {
+		s, err := NewAdaptiveSink(100, 0, DefaultSinkConfig(sinkTypeDDS))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addUniform(s, values)
+		return s
+	}
+
+	t.Run("exact", func(t *testing.T) {
+		t.Parallel()
+
+		// The limits apply to each sink on its own, so merging exact
+		// sinks keeps them exact, even beyond the limits.
+		merged := newSink(0)
+		for i := 0; i < 10; i++ {
+			if err := merged.Merge(newSink(100)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !merged.IsExact() {
+			t.Fatal("expected the merged sink to be exact")
+		}
+		if got := merged.Count(); got != 1000 {
+			t.Errorf("expected 1000 values, got %d", got)
+		}
+
+		all, err := MergeAll(newSink(100), newSink(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsExact(all) {
+			t.Fatal("expected the sink merged with MergeAll to be exact")
+		}
+	})
+
+	t.Run("converted", func(t *testing.T) {
+		t.Parallel()
+
+		// Once any of them is converted, the merged one is converted too.
+		for _, sinks := range [][2]*AdaptiveSink{
+			{newSink(100), newSink(1000)},
+			{newSink(1000), newSink(100)},
+			{newSink(1000), newSink(1000)},
+		} {
+			merged, other := sinks[0], sinks[1]
+			want := merged.Count() + other.Count()
+			if err := merged.Merge(other); err != nil {
+				t.Fatal(err)
+			}
+			if merged.IsExact() {
+				t.Fatal("expected the merged sink to be converted")
+			}
+			if got := merged.Count(); got != want {
+				t.Errorf("expected %d values, got %d", want, got)
+			}
+		}
+	})
+}
+
+func TestAdaptiveSinkMergeIncompatible(t *testing.T) {
+	t.Parallel()
+
+	mustAdaptive := func(maxCount, maxBytes uint64, target string) *AdaptiveSink {
+		cfg, err := ParseSinkConfig(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewAdaptiveSink(maxCount, maxBytes, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	for name, toMerge := range map[string]Sink{
+		"different type":   NewK6Sink(),
+		"different count":  mustAdaptive(200, 0, sinkTypeDDS),
+		"different memory": mustAdaptive(100, 800, sinkTypeDDS),
+		"different target": mustAdaptive(100, 0, sinkTypeTDigest),
+		// The target parameters must match too, not only its type.
+		"different target parameters": mustAdaptive(100, 0, "dds(accuracy=0.05)"),
+	} {
+		s := mustAdaptive(100, 0, sinkTypeDDS)
+		if err := s.Merge(toMerge); !errors.Is(err, ErrIncompatibleSinks) {
+			t.Errorf("%s: expected %v, got %v", name, ErrIncompatibleSinks, err)
+		}
+		if err := Compatible(s, toMerge); !errors.Is(err, ErrIncompatibleSinks) {
+			t.Errorf("%s: expected Compatible to return %v, got %v", name, ErrIncompatibleSinks, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package trend
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// CheckedSink is a Sink implementation used to check the accuracy of an approximate
+// Sink (e.g. DDSketchHistogramSink): it behaves like it, but it also records all the
+// values into an exact *K6Sink, so the stats of both can be compared (see Exact).
+//
+// As it keeps all the values, it is meant for diagnostic purposes only, to gather
+// evidence of the accuracy of the approximate sinks before relying on them.
+type CheckedSink struct {
+	approx Sink
+	exact  *K6Sink
+}
+
+// NewCheckedSink returns a CheckedSink that checks the given Sink against an exact one.
+// The *K6Sink is already exact, so it is returned as is.
+func NewCheckedSink(s Sink) Sink {
+	if _, isK6 := s.(*K6Sink); isK6 {
+		return s
+	}
+	return &CheckedSink{approx: s, exact: NewK6Sink()}
+}
+
+// newLike instantiates a new empty CheckedSink, with the same approximate Sink.
+func (c *CheckedSink) newLike() *CheckedSink {
+	return &CheckedSink{approx: NewSinkLike(c.approx), exact: NewK6Sink()}
+}
+
+// compatible returns an error if the approximate sink of the given CheckedSink
+// cannot be merged into this one's (see Compatible). The exact ones always can.
+func (c *CheckedSink) compatible(other *CheckedSink) error {
+	return Compatible(c.approx, other.approx)
+}
+
+// Exact returns the exact Sink, with all the values recorded by the checked one.
+func (c *CheckedSink) Exact() Sink { return c.exact }
+
+// OutOfRange returns the number of values that couldn't be recorded by the
+// approximate Sink, if it has a limited range (e.g. HdrHistogramSink).
+func (c *CheckedSink) OutOfRange() uint64 {
+	if ranged, ok := c.approx.(interface{ OutOfRange() uint64 }); ok {
+		return ranged.OutOfRange()
+	}
+	return 0
+}
+
+// IsEmpty indicates whether the TrendSink is empty.
+func (c *CheckedSink) IsEmpty() bool { return c.approx.IsEmpty() }
+
+// Add implements the Sink interface, recording the value of the given metrics.Sample.
+func (c *CheckedSink) Add(s metrics.Sample) {
+	c.approx.Add(s)
+	c.exact.Add(s)
+}
+
+// P implements the Sink interface, returning the value at percentile.
+func (c *CheckedSink) P(pct float64) float64 { return c.approx.P(pct) }
+
+// Min implements the Sink interface, returning the minimum value recorded.
+func (c *CheckedSink) Min() float64 { return c.approx.Min() }
+
+// Max implements the Sink interface, returning the maximum value recorded.
+func (c *CheckedSink) Max() float64 { return c.approx.Max() }
+
+// Count implements the Sink interface, returning the total amount of values recorded.
+func (c *CheckedSink) Count() uint64 { return c.approx.Count() }
+
+// Avg implements the Sink interface, returning the average (mean) of values recorded.
+func (c *CheckedSink) Avg() float64 { return c.approx.Avg() }
+
+// Variance implements the Sink interface, returning the variance of values recorded.
+func (c *CheckedSink) Variance() float64 { return c.approx.Variance() }
+
+// MAD implements the Sink interface, returning the median absolute deviation of values recorded.
+func (c *CheckedSink) MAD() float64 { return c.approx.MAD() }
+
+// Rank implements the Sink interface, returning the fraction
+// of values recorded lower than or equal to the given one.
+func (c *CheckedSink) Rank(value float64) float64 { return c.approx.Rank(value) }
+
+// Format trend and return a map
+func (c *CheckedSink) Format(t time.Duration) map[string]float64 { return c.approx.Format(t) }
+
+// Sort sorts the values of both sinks, if they keep them (see K6Sink.Sort).
+func (c *CheckedSink) Sort() {
+	if sortable, ok := c.approx.(interface{ Sort() }); ok {
+		sortable.Sort()
+	}
+	c.exact.Sort()
+}
+
+// Merge merges two Sink instances.
+// It returns an error if their approximate sinks don't match (see Compatible),
+// in which case none of them is merged, so both stay consistent.
+func (c *CheckedSink) Merge(s Sink) error {
+	toMerge, ok := s.(*CheckedSink)
+	if !ok {
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, c, s)
+	}
+
+	// The compatibility is checked before merging any of them,
+	// as the approximate ones could fail after merging the exact ones.
+	if err := c.compatible(toMerge); err != nil {
+		return err
+	}
+
+	return errors.Join(c.approx.Merge(toMerge.approx), c.exact.Merge(toMerge.exact))
+}
+
+// We want to make sure that the *CheckedSink
+// implements the Sink interface.
+var _ Sink = &CheckedSink{}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+// Both sinks are encoded as by Marshal, the approximate one prefixed
+// by its length (uvarint), followed by the exact one.
+func (c *CheckedSink) MarshalBinary() ([]byte, error) {
+	approx, err := Marshal(c.approx)
+	if err != nil {
+		return nil, err
+	}
+
+	exact, err := Marshal(c.exact)
+	if err != nil {
+		return nil, err
+	}
+
+	data := binary.AppendUvarint(nil, uint64(len(approx)))
+	data = append(data, approx...)
+	return append(data, exact...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (c *CheckedSink) UnmarshalBinary(data []byte) error {
+	n, read := binary.Uvarint(data)
+	if read <= 0 || uint64(len(data)-read) < n {
+		return fmt.Errorf("malformed checked trend sink data")
+	}
+	data = data[read:]
+
+	approx, err := Unmarshal(data[:n])
+	if err != nil {
+		return err
+	}
+
+	exact, err := Unmarshal(data[n:])
+	if err != nil {
+		return err
+	}
+
+	typed, ok := exact.(*K6Sink)
+	if !ok {
+		return fmt.Errorf("malformed checked trend sink data: unexpected exact sink %T", exact)
+	}
+
+	*c = CheckedSink{approx: approx, exact: typed}
+	return nil
+}
@@ -0,0 +1,70 @@
+package trend
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckedSinkMergeIncompatible(t *testing.T) {
+	t.Parallel()
+
+	c := NewCheckedSink(NewDDSketchHistogramSink()).(*CheckedSink)
+	addValues(c, 100)
+
+	accurate, err := NewDDSketchHistogramSinkWith(0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, approx := range map[string]Sink{
+		"different type":       NewTDigestSink(),
+		"different parameters": accurate,
+	} {
+		other := NewCheckedSink(approx).(*CheckedSink)
+		addValues(other, 10)
+
+		err := c.Merge(other)
+		if !errors.Is(err, ErrIncompatibleSinks) {
+			t.Fatalf("%s: expected an incompatible sinks error, got %v", name, err)
+		}
+		if err := Compatible(c, other); !errors.Is(err, ErrIncompatibleSinks) {
+			t.Fatalf("%s: expected Compatible to return an incompatible sinks error, got %v", name, err)
+		}
+
+		// None of them must have been merged.
+		if approx, exact := c.Count(), c.Exact().Count(); approx != 100 || exact != 100 {
+			t.Fatalf("%s: expected both sinks to keep 100 values, got %d and %d", name, approx, exact)
+		}
+	}
+}
+
+func TestCheckedSinkMerge(t *testing.T) {
+	t.Parallel()
+
+	c := NewCheckedSink(NewDDSketchHistogramSink()).(*CheckedSink)
+	addValues(c, 100)
+
+	other := NewCheckedSink(NewDDSketchHistogramSink()).(*CheckedSink)
+	addValues(other, 10)
+
+	if err := c.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if approx, exact := c.Count(), c.Exact().Count(); approx != 110 || exact != 110 {
+		t.Fatalf("expected both sinks to hold 110 values, got %d and %d", approx, exact)
+	}
+}
+
+func TestCheckedSinkRoundTripKeepsExact(t *testing.T) {
+	t.Parallel()
+
+	s := NewCheckedSink(NewHdrHistogramSink()).(*CheckedSink)
+	addValues(s, 1000)
+
+	got, err := Unmarshal(mustMarshal(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertSameStats(t, s.Exact(), got.(*CheckedSink).Exact(), 0)
+}
@@ -0,0 +1,336 @@
+package trend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// CircllhistSink is a Sink implementation that relies on a log-linear
+// histogram, compatible with the OpenHistogram circllhist: values are
+// grouped into buckets of two significant decimal digits (e.g. [1.2, 1.3),
+// [120, 130)), so it has a relative error of up to 5%, and it is bounded
+// in memory (the number of buckets is limited). Besides, it keeps the
+// exact count, min, max and sum.
+type CircllhistSink struct {
+	bins map[circllhistBin]uint64
+
+	count    uint64
+	min, max float64
+	sum      float64
+}
+
+// NewCircllhistSink instantiates a new CircllhistSink.
+func NewCircllhistSink() *CircllhistSink {
+	return &CircllhistSink{bins: make(map[circllhistBin]uint64)}
+}
+
+// IsEmpty indicates whether the TrendSink is empty.
+func (c *CircllhistSink) IsEmpty() bool { return c.count == 0 }
+
+// Add implements the Sink interface, recording the value of the given metrics.Sample.
+func (c *CircllhistSink) Add(s metrics.Sample) {
+	bin, ok := newCircllhistBin(s.Value)
+	if !ok {
+		// Values out of the range of the histogram (i.e.
+		// NaN, infinite or greater than 1e128) are ignored.
+		return
+	}
+	c.bins[bin]++
+
+	if c.count == 0 {
+		c.min, c.max = s.Value, s.Value
+	} else {
+		c.min, c.max = math.Min(c.min, s.Value), math.Max(c.max, s.Value)
+	}
+	c.count++
+	c.sum += s.Value
+}
+
+// P implements the Sink interface, returning the value at percentile,
+// interpolated linearly within the bucket where it falls in.
+func (c *CircllhistSink) P(pct float64) float64 {
+	switch {
+	case c.count == 0:
+		return 0
+	case pct <= 0:
+		return c.min
+	case pct >= 1:
+		return c.max
+	}
+
+	target := pct * float64(c.count)
+
+	var seen float64
+	for _, bin := range c.sortedBins() {
+		n := float64(c.bins[bin])
+		if seen+n >= target {
+			lower, width := bin.bounds()
+			value := lower + width*(target-seen)/n
+			// The interpolated value may fall out
+			// of the range of the recorded values.
+			return math.Min(math.Max(value, c.min), c.max)
+		}
+		seen += n
+	}
+
+	return c.max
+}
+
+// sortedBins returns the bins of the histogram, sorted by their lower bound.
+func (c *CircllhistSink) sortedBins() []circllhistBin {
+	bins := make([]circllhistBin, 0, len(c.bins))
+	for bin := range c.bins {
+		bins = append(bins, bin)
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		li, _ := bins[i].bounds()
+		lj, _ := bins[j].bounds()
+		return li < lj
+	})
+	return bins
+}
+
+// Min implements the Sink interface, returning the minimum value recorded.
+func (c *CircllhistSink) Min() float64 {
+	return c.min
+}
+
+// Max implements the Sink interface, returning the maximum value recorded.
+func (c *CircllhistSink) Max() float64 {
+	return c.max
+}
+
+// Count implements the Sink interface, returning the total amount of values recorded.
+func (c *CircllhistSink) Count() uint64 {
+	return c.count
+}
+
+// Avg implements the Sink interface, returning the average (mean) of values recorded.
+func (c *CircllhistSink) Avg() float64 {
+	if c.count > 0 {
+		return c.sum / float64(c.count)
+	}
+	return 0
+}
+
+// Variance implements the Sink interface, returning the variance of
+// values recorded, approximated from the middle value of each bucket.
+func (c *CircllhistSink) Variance() float64 {
+	return varianceOf(c.buckets())
+}
+
+// MAD implements the Sink interface, returning the median absolute deviation
+// of values recorded, approximated from the middle value of each bucket.
+func (c *CircllhistSink) MAD() float64 {
+	return madOf(c.buckets(), c.P(0.5))
+}
+
+// Rank implements the Sink interface, returning the fraction of values recorded lower
+// than or equal to the given one, approximated from the middle value of each bucket.
+func (c *CircllhistSink) Rank(value float64) float64 {
+	return rankOf(c.buckets(), value, c.min, c.max)
+}
+
+// buckets returns the buckets of the histogram.
+func (c *CircllhistSink) buckets() []weightedValue {
+	buckets := make([]weightedValue, 0, len(c.bins))
+	for bin, n := range c.bins {
+		lower, width := bin.bounds()
+		buckets = append(buckets, weightedValue{value: lower + width/2, weight: float64(n)})
+	}
+	return buckets
+}
+
+// Format trend and return a map
+func (c *CircllhistSink) Format(_ time.Duration) map[string]float64 {
+	return map[string]float64{
+		"min":   c.Min(),
+		"max":   c.Max(),
+		"avg":   c.Avg(),
+		"med":   c.P(0.5),
+		"p(90)": c.P(0.90),
+		"p(95)": c.P(0.95),
+	}
+}
+
+// Merge merges two Sink instances.
+func (c *CircllhistSink) Merge(s Sink) error {
+	toMerge, ok := s.(*CircllhistSink)
+	if !ok {
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, c, s)
+	}
+
+	if toMerge.IsEmpty() {
+		return nil
+	}
+
+	if c.IsEmpty() {
+		c.min, c.max = toMerge.min, toMerge.max
+	} else {
+		c.min, c.max = math.Min(c.min, toMerge.min), math.Max(c.max, toMerge.max)
+	}
+	c.count += toMerge.count
+	c.sum += toMerge.sum
+
+	for bin, n := range toMerge.bins {
+		c.bins[bin] += n
+	}
+
+	return nil
+}
+
+// We want to make sure that the *CircllhistSink
+// implements the Sink interface.
+var _ Sink = &CircllhistSink{}
+
+// circllhistSinkHeader is the fixed-size part of the encoded
+// CircllhistSink, followed by the encoded histogram.
+type circllhistSinkHeader struct {
+	Count    uint64
+	Min, Max float64
+	Sum      float64
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface, by using
+// the libcircllhist binary encoding (all numbers big-endian): the number of
+// bins (2 bytes), and for each one of them, its value and exponent (1 byte each),
+// the number of bytes of the count minus one (1 byte), and the count itself.
+// It is preceded by the exact count, min, max and sum.
+func (c *CircllhistSink) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	header := circllhistSinkHeader{Count: c.count, Min: c.min, Max: c.max, Sum: c.sum}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+
+	bins := c.sortedBins()
+	if len(bins) > math.MaxUint16 {
+		return nil, fmt.Errorf("too many circllhist bins: %d", len(bins))
+	}
+
+	data := binary.BigEndian.AppendUint16(buf.Bytes(), uint16(len(bins)))
+	for _, bin := range bins {
+		count := binary.BigEndian.AppendUint64(nil, c.bins[bin])
+		// The count is encoded with the minimum number of bytes.
+		for len(count) > 1 && count[0] == 0 {
+			count = count[1:]
+		}
+		data = append(data, byte(bin.val), byte(bin.exp), byte(len(count)-1))
+		data = append(data, count...)
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (c *CircllhistSink) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var header circllhistSinkHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("malformed circllhist trend sink data: %w", err)
+	}
+
+	var nbins uint16
+	if err := binary.Read(r, binary.BigEndian, &nbins); err != nil {
+		return fmt.Errorf("malformed circllhist trend sink data: %w", err)
+	}
+
+	bins := make(map[circllhistBin]uint64, nbins)
+	for i := 0; i < int(nbins); i++ {
+		var meta [3]byte
+		if _, err := r.Read(meta[:]); err != nil {
+			return fmt.Errorf("malformed circllhist trend sink data: %w", err)
+		}
+
+		size := int(meta[2]) + 1
+		if size > 8 {
+			return fmt.Errorf("malformed circllhist trend sink data: invalid count size %d", size)
+		}
+		if r.Len() < size {
+			return fmt.Errorf("malformed circllhist trend sink data: truncated bin %d", i)
+		}
+		count := make([]byte, 8)
+		_, _ = r.Read(count[8-size:])
+
+		bins[circllhistBin{val: int8(meta[0]), exp: int8(meta[1])}] = binary.BigEndian.Uint64(count)
+	}
+
+	if r.Len() > 0 {
+		return fmt.Errorf("malformed circllhist trend sink data: %d unexpected bytes", r.Len())
+	}
+
+	*c = CircllhistSink{
+		bins:  bins,
+		count: header.Count,
+		min:   header.Min,
+		max:   header.Max,
+		sum:   header.Sum,
+	}
+	return nil
+}
+
+// circllhistBin identifies a bucket of the histogram: values between
+// val*10^(exp-1) and (val+1)*10^(exp-1), where val has two digits (10 to 99,
+// or -99 to -10 for negative values). The zero bucket has both set to zero.
+type circllhistBin struct {
+	val int8
+	exp int8
+}
+
+// newCircllhistBin returns the bin for the given value, and whether
+// it is within the range of the histogram (values smaller than
+// 1e-128 in absolute value fall into the zero bucket).
+func newCircllhistBin(v float64) (circllhistBin, bool) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return circllhistBin{}, false
+	}
+	if v == 0 {
+		return circllhistBin{}, true
+	}
+
+	abs := math.Abs(v)
+	exp := int(math.Floor(math.Log10(abs)))
+
+	// The small delta compensates the floating point errors,
+	// like 0.3 being represented as 0.29999999999999998.
+	val := int(math.Floor(abs*math.Pow10(1-exp) + 1e-9))
+	switch {
+	case val >= 100:
+		val, exp = val/10, exp+1
+	case val < 10:
+		exp--
+		val = int(math.Floor(abs*math.Pow10(1-exp) + 1e-9))
+	}
+
+	switch {
+	case exp < math.MinInt8:
+		return circllhistBin{}, true
+	case exp > math.MaxInt8:
+		return circllhistBin{}, false
+	}
+
+	if v < 0 {
+		val = -val
+	}
+	return circllhistBin{val: int8(val), exp: int8(exp)}, true
+}
+
+// bounds returns the lower bound and the width of the bin.
+func (b circllhistBin) bounds() (lower, width float64) {
+	if b.val == 0 {
+		return 0, 0
+	}
+
+	width = math.Pow10(int(b.exp) - 1)
+	if b.val > 0 {
+		return float64(b.val) * width, width
+	}
+	return float64(b.val-1) * width, width
+}
@@ -0,0 +1,91 @@
+package trend
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCircllhistSinkAccuracy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("uniform", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewCircllhistSink()
+		addUniform(s, 100000)
+
+		assertUniformStats(t, s, 100000, 0.001)
+	})
+
+	t.Run("exponential", func(t *testing.T) {
+		t.Parallel()
+
+		// Every value falls into a bucket that is, at most,
+		// 10% of its lower bound wide, in any order of magnitude.
+		s, exact := NewCircllhistSink(), NewK6Sink()
+		addValues(s, 10000)
+		addValues(exact, 10000)
+
+		for _, pct := range []float64{0.01, 0.25, 0.5, 0.9, 0.95, 0.99, 0.999} {
+			if want, got := exact.P(pct), s.P(pct); math.Abs(want-got) > 0.1*want {
+				t.Errorf("p(%g): expected %v (±10%%), got %v", pct*100, want, got)
+			}
+		}
+	})
+}
+
+func TestCircllhistSinkMerge(t *testing.T) {
+	t.Parallel()
+
+	s, other := NewCircllhistSink(), NewCircllhistSink()
+	addUniform(s, 50000)
+	for i := 50001; i <= 100000; i++ {
+		other.Add(sample(float64(i)))
+	}
+
+	if err := s.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	assertUniformStats(t, s, 100000, 0.001)
+
+	// Merging an empty sink must leave it as is.
+	if err := s.Merge(NewCircllhistSink()); err != nil {
+		t.Fatal(err)
+	}
+	assertUniformStats(t, s, 100000, 0.001)
+}
+
+func TestCircllhistSinkMergeIncompatible(t *testing.T) {
+	t.Parallel()
+
+	// The circllhist buckets are fixed, so it is only incompatible with other implementations.
+	if err := NewCircllhistSink().Merge(NewK6Sink()); !errors.Is(err, ErrIncompatibleSinks) {
+		t.Errorf("expected %v, got %v", ErrIncompatibleSinks, err)
+	}
+}
+
+func TestCircllhistBin(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		value float64
+		want  circllhistBin
+		ok    bool
+	}{
+		{value: 0, want: circllhistBin{}, ok: true},
+		{value: 1, want: circllhistBin{val: 10, exp: 0}, ok: true},
+		{value: 0.3, want: circllhistBin{val: 30, exp: -1}, ok: true},
+		{value: 123.4, want: circllhistBin{val: 12, exp: 2}, ok: true},
+		{value: -123.4, want: circllhistBin{val: -12, exp: 2}, ok: true},
+		{value: 1e-200, want: circllhistBin{}, ok: true},
+		{value: 1e200, ok: false},
+		{value: math.Inf(1), ok: false},
+		{value: math.NaN(), ok: false},
+	} {
+		got, ok := newCircllhistBin(tc.value)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%v: expected %v (%t), got %v (%t)", tc.value, tc.want, tc.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package trend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+// Default parameters of the HdrHistogramSink, DDSketchHistogramSink,
+// TDigestSink, ReservoirSink and AdaptiveSink.
+const (
+	defaultHdrLowest   = 1
+	defaultHdrHighest  = 100000000000
+	defaultHdrDigits   = 5
+	defaultDDSAccuracy = 0.01
+
+	defaultTDigestCompression = 100
+	defaultReservoirSize      = 10000
+
+	defaultAdaptiveCount = 100000
+	defaultAdaptiveTo    = sinkTypeDDS
+)
+
+// SinkConfig defines the Sink implementation to use,
+// and its parameters, if it has any.
+//
+// Use ParseSinkConfig to initialize it, so it is validated.
+type SinkConfig struct {
+	// Type is the Sink implementation: "k6", "hdr", "dds", "tdigest", "reservoir", "circllhist" or "adaptive".
+	Type string
+
+	// HdrLowest and HdrHighest are the range of values tracked by the
+	// HdrHistogramSink, and HdrDigits is the number of significant digits.
+	// HdrScale is the factor values are multiplied by before being recorded,
+	// so the range applies to the scaled values. If zero, it is derived from
+	// the metric's value type (see hdrScaleFor).
+	HdrLowest  int64
+	HdrHighest int64
+	HdrDigits  int
+	HdrScale   float64
+
+	// DDSAccuracy is the relative accuracy of the DDSketchHistogramSink.
+	DDSAccuracy float64
+
+	// TDigestCompression is the compression of the TDigestSink.
+	TDigestCompression float64
+
+	// ReservoirSize is the number of values kept by the ReservoirSink.
+	ReservoirSize int
+
+	// AdaptiveCount and AdaptiveMemory are the number of values, and of bytes
+	// used by them, that an AdaptiveSink holds before converting itself into
+	// the AdaptiveTo type, optionally with its parameters, in the format
+	// expected by ParseSinkConfig (e.g. "hdr(highest=1e12)"). Zero means no limit.
+	// They apply to each time series on its own (see AdaptiveSink).
+	AdaptiveCount  uint64
+	AdaptiveMemory uint64
+	AdaptiveTo     string
+}
+
+// DefaultSinkConfig returns the SinkConfig of the given type,
+// with its default parameters.
+func DefaultSinkConfig(sinkType string) SinkConfig {
+	return SinkConfig{
+		Type:        sinkType,
+		HdrLowest:   defaultHdrLowest,
+		HdrHighest:  defaultHdrHighest,
+		HdrDigits:   defaultHdrDigits,
+		DDSAccuracy: defaultDDSAccuracy,
+
+		TDigestCompression: defaultTDigestCompression,
+
+		ReservoirSize: defaultReservoirSize,
+
+		AdaptiveCount: defaultAdaptiveCount,
+		AdaptiveTo:    defaultAdaptiveTo,
+	}
+}
+
+// ParseSinkConfig parses a SinkConfig, that is a Sink type optionally followed by
+// its parameters between parentheses. The parameters that are not given keep
+// their default values. For instance:
+//   - "k6"
+//   - "hdr(lowest=1,highest=1e11,digits=5,scale=1000)"
+//   - "dds(accuracy=0.01)"
+//   - "tdigest(compression=100)"
+//   - "reservoir(size=10000)"
+//   - "circllhist"
+//   - "adaptive(count=100000,memory=8MB,to=dds)"
+//   - "adaptive(count=100000,to=hdr(highest=1e12,digits=3))"
+func ParseSinkConfig(s string) (SinkConfig, error) {
+	s = strings.TrimSpace(s)
+
+	sinkType, params := s, ""
+	if idx := strings.Index(s, "("); idx >= 0 {
+		if !strings.HasSuffix(s, ")") {
+			return SinkConfig{}, fmt.Errorf("invalid trend sink '%s', missing closing parenthesis", s)
+		}
+		sinkType, params = strings.TrimSpace(s[:idx]), s[idx+1:len(s)-1]
+	}
+
+	cfg := DefaultSinkConfig(sinkType)
+
+	for _, param := range splitParams(params) {
+		param = strings.TrimSpace(param)
+		if len(param) == 0 {
+			continue
+		}
+
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return SinkConfig{}, fmt.Errorf("invalid trend sink parameter '%s', expected 'name=value'", param)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		if err := cfg.set(key, value); err != nil {
+			return SinkConfig{}, fmt.Errorf("invalid trend sink '%s': %w", s, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return SinkConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+func (c *SinkConfig) set(key, value string) error {
+	var err error
+	switch {
+	case c.Type == sinkTypeHdr && key == "lowest":
+		c.HdrLowest, err = parseInt(value)
+	case c.Type == sinkTypeHdr && key == "highest":
+		c.HdrHighest, err = parseInt(value)
+	case c.Type == sinkTypeHdr && key == "digits":
+		var digits int64
+		digits, err = parseInt(value)
+		c.HdrDigits = int(digits)
+	case c.Type == sinkTypeHdr && key == "scale":
+		c.HdrScale, err = strconv.ParseFloat(value, 64)
+	case c.Type == sinkTypeDDS && key == "accuracy":
+		c.DDSAccuracy, err = strconv.ParseFloat(value, 64)
+	case c.Type == sinkTypeTDigest && key == "compression":
+		c.TDigestCompression, err = strconv.ParseFloat(value, 64)
+	case c.Type == sinkTypeReservoir && key == "size":
+		var size int64
+		size, err = parseInt(value)
+		c.ReservoirSize = int(size)
+	case c.Type == sinkTypeAdaptive && key == "count":
+		var count int64
+		count, err = parseInt(value)
+		if count < 0 {
+			err = fmt.Errorf("negative count: %d", count)
+		}
+		c.AdaptiveCount = uint64(count)
+	case c.Type == sinkTypeAdaptive && key == "memory":
+		c.AdaptiveMemory, err = parseBytes(value)
+	case c.Type == sinkTypeAdaptive && key == "to":
+		// The target is kept in its canonical form (just the type, if it has
+		// its default parameters), so the configs with the same target are equal.
+		var target SinkConfig
+		if target, err = ParseSinkConfig(value); err != nil {
+			return fmt.Errorf("invalid value '%s' for the '%s' parameter: %w", value, key, err)
+		}
+		c.AdaptiveTo = target.Type
+		if target != DefaultSinkConfig(target.Type) {
+			c.AdaptiveTo = target.String()
+		}
+	default:
+		return fmt.Errorf("unknown parameter '%s' for the '%s' type", key, c.Type)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid value '%s' for the '%s' parameter", value, key)
+	}
+
+	return nil
+}
+
+// splitParams splits the given Sink parameters by commas,
+// except the ones between parentheses, that belong to the
+// parameters of a nested Sink type (e.g. "to=hdr(lowest=1,digits=3)").
+func splitParams(params string) []string {
+	var (
+		split []string
+		depth int
+		start int
+	)
+	for i, r := range params {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				split = append(split, params[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(split, params[start:])
+}
+
+// parseInt parses an integer, also accepting the
+// scientific notation (e.g. 1e11) for big numbers.
+func parseInt(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != float64(int64(f)) {
+		return 0, fmt.Errorf("not an integer: %s", s)
+	}
+
+	return int64(f), nil
+}
+
+// parseBytes parses an amount of bytes, optionally followed
+// by a unit: B, KB, MB or GB (in powers of 1024).
+func parseBytes(s string) (uint64, error) {
+	units := []struct {
+		suffix string
+		factor uint64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+	factor := uint64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(strings.ToUpper(s), unit.suffix) {
+			s, factor = strings.TrimSpace(s[:len(s)-len(unit.suffix)]), unit.factor
+			break
+		}
+	}
+
+	n, err := parseInt(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid amount of bytes: %s", s)
+	}
+
+	return uint64(n) * factor, nil
+}
+
+// Validate returns an error if the SinkConfig holds
+// an unknown type or invalid parameters.
+func (c SinkConfig) Validate() error {
+	switch c.Type {
+	case sinkTypeK6, sinkTypeCircllhist:
+		return nil
+	case sinkTypeHdr:
+		scale := c.HdrScale
+		if scale == 0 {
+			scale = hdrScaleFor(metrics.Default)
+		}
+		_, err := NewHdrHistogramSinkWith(c.HdrLowest, c.HdrHighest, c.HdrDigits, scale)
+		return err
+	case sinkTypeDDS:
+		_, err := NewDDSketchHistogramSinkWith(c.DDSAccuracy)
+		return err
+	case sinkTypeTDigest:
+		_, err := NewTDigestSinkWith(c.TDigestCompression)
+		return err
+	case sinkTypeReservoir:
+		_, err := NewReservoirSinkWith(c.ReservoirSize)
+		return err
+	case sinkTypeAdaptive:
+		target, err := ParseSinkConfig(c.AdaptiveTo)
+		if err != nil {
+			return fmt.Errorf("invalid adaptive trend sink target: %w", err)
+		}
+		_, err = NewAdaptiveSink(c.AdaptiveCount, c.AdaptiveMemory, target)
+		return err
+	default:
+		return fmt.Errorf("unknown trend sink type '%s', possible values are: %s, %s, %s, %s, %s, %s, %s",
+			c.Type, sinkTypeK6, sinkTypeHdr, sinkTypeDDS, sinkTypeTDigest, sinkTypeReservoir, sinkTypeCircllhist,
+			sinkTypeAdaptive)
+	}
+}
+
+// NewSink instantiates a new Sink as defined by the SinkConfig, for
+// a metric that contains values of the given type.
+// It panics if the SinkConfig is not valid (see Validate).
+func (c SinkConfig) NewSink(contains metrics.ValueType) Sink {
+	var (
+		s   Sink
+		err error
+	)
+
+	switch c.Type {
+	case sinkTypeK6:
+		s = NewK6Sink()
+	case sinkTypeCircllhist:
+		s = NewCircllhistSink()
+	case sinkTypeHdr:
+		scale := c.HdrScale
+		if scale == 0 {
+			scale = hdrScaleFor(contains)
+		}
+		s, err = NewHdrHistogramSinkWith(c.HdrLowest, c.HdrHighest, c.HdrDigits, scale)
+	case sinkTypeDDS:
+		s, err = NewDDSketchHistogramSinkWith(c.DDSAccuracy)
+	case sinkTypeTDigest:
+		s, err = NewTDigestSinkWith(c.TDigestCompression)
+	case sinkTypeReservoir:
+		s, err = NewReservoirSinkWith(c.ReservoirSize)
+	case sinkTypeAdaptive:
+		// The target is resolved for the given value type now,
+		// because the conversion happens later on.
+		var target SinkConfig
+		if target, err = ParseSinkConfig(c.AdaptiveTo); err != nil {
+			break
+		}
+		if target.Type == sinkTypeHdr && target.HdrScale == 0 {
+			target.HdrScale = hdrScaleFor(contains)
+		}
+		s, err = NewAdaptiveSink(c.AdaptiveCount, c.AdaptiveMemory, target)
+	default:
+		err = c.Validate()
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// String returns the SinkConfig in the format expected by ParseSinkConfig.
+func (c SinkConfig) String() string {
+	switch c.Type {
+	case sinkTypeHdr:
+		if c.HdrScale == 0 {
+			return fmt.Sprintf("%s(lowest=%d,highest=%d,digits=%d)", c.Type, c.HdrLowest, c.HdrHighest, c.HdrDigits)
+		}
+		return fmt.Sprintf("%s(lowest=%d,highest=%d,digits=%d,scale=%g)",
+			c.Type, c.HdrLowest, c.HdrHighest, c.HdrDigits, c.HdrScale)
+	case sinkTypeDDS:
+		return fmt.Sprintf("%s(accuracy=%g)", c.Type, c.DDSAccuracy)
+	case sinkTypeTDigest:
+		return fmt.Sprintf("%s(compression=%g)", c.Type, c.TDigestCompression)
+	case sinkTypeReservoir:
+		return fmt.Sprintf("%s(size=%d)", c.Type, c.ReservoirSize)
+	case sinkTypeAdaptive:
+		return fmt.Sprintf("%s(count=%d,memory=%d,to=%s)", c.Type, c.AdaptiveCount, c.AdaptiveMemory, c.AdaptiveTo)
+	default:
+		return c.Type
+	}
+}
+
+// hdrScaleFor returns the HdrHistogramSink scale used by default for metrics
+// that contain values of the given type: data values (bytes) are integers,
+// while the rest are recorded with three decimals (i.e. microseconds
+// precision for time values, in milliseconds).
+func hdrScaleFor(contains metrics.ValueType) float64 {
+	if contains == metrics.Data {
+		return 1
+	}
+	return 1000
+}
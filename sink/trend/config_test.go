@@ -0,0 +1,73 @@
+package trend
+
+import (
+	"testing"
+
+	"go.k6.io/k6/metrics"
+)
+
+func TestParseSinkConfigAdaptiveTarget(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		raw  string
+		want string
+	}{
+		{raw: "adaptive", want: "dds"},
+		{raw: "adaptive(to=tdigest)", want: "tdigest"},
+		{raw: "adaptive(to=dds(accuracy=0.01))", want: "dds"},
+		{raw: "adaptive(to=dds(accuracy=0.001))", want: "dds(accuracy=0.001)"},
+		{raw: "adaptive(count=10, to=hdr(highest=1e12, digits=3), memory=1MB)", want: "hdr(lowest=1,highest=1000000000000,digits=3)"},
+	} {
+		cfg, err := ParseSinkConfig(tc.raw)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.raw, err)
+		}
+		if cfg.AdaptiveTo != tc.want {
+			t.Errorf("%s: expected the '%s' target, got '%s'", tc.raw, tc.want, cfg.AdaptiveTo)
+		}
+
+		// It must be parsed back into the same config.
+		parsed, err := ParseSinkConfig(cfg.String())
+		if err != nil {
+			t.Fatalf("%s: %v", cfg, err)
+		}
+		if parsed != cfg {
+			t.Errorf("%s: expected %+v, got %+v", cfg, cfg, parsed)
+		}
+	}
+
+	for _, raw := range []string{
+		"adaptive(to=hdr(digits=9))",
+		"adaptive(to=dds(accuracy=0.01)",
+		"adaptive(to=k6)",
+		"adaptive(to=adaptive(to=dds))",
+	} {
+		if _, err := ParseSinkConfig(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestAdaptiveSinkConvertsIntoTargetWithParameters(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseSinkConfig("adaptive(count=10,to=hdr(digits=2))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := cfg.NewSink(metrics.Time).(*AdaptiveSink)
+	addValues(s, 100)
+	if s.IsExact() {
+		t.Fatal("expected the sink to be converted")
+	}
+
+	hdr, ok := s.approx.(HdrHistogramSink)
+	if !ok {
+		t.Fatalf("expected an hdr sink, got a %T", s.approx)
+	}
+	if digits := hdr.hdr.SignificantFigures(); digits != 2 || hdr.scale != hdrScaleFor(metrics.Time) {
+		t.Fatalf("expected 2 digits and the time scale, got %d and %v", digits, hdr.scale)
+	}
+}
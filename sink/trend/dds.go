@@ -1,9 +1,12 @@
 package trend
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/DataDog/sketches-go/ddsketch"
+	"github.com/DataDog/sketches-go/ddsketch/pb/sketchpb"
+	"google.golang.org/protobuf/proto"
 
 	"go.k6.io/k6/metrics"
 )
@@ -18,11 +21,43 @@ type DDSketchHistogramSink struct {
 // NewDDSketchHistogramSink instantiates a new
 // DDSketchHistogramSink with a relative accuracy of 0.01.
 func NewDDSketchHistogramSink() DDSketchHistogramSink {
-	// FIXME: Handle error
-	dds, _ := ddsketch.NewDefaultDDSketch(0.01)
+	// The default relative accuracy is valid,
+	// so the error can be safely ignored.
+	s, _ := NewDDSketchHistogramSinkWith(defaultDDSAccuracy)
+	return s
+}
+
+// NewDDSketchHistogramSinkWith instantiates a new DDSketchHistogramSink with the given
+// relative accuracy. It returns an error if it isn't within the (0, 1) range.
+func NewDDSketchHistogramSinkWith(accuracy float64) (DDSketchHistogramSink, error) {
+	if accuracy <= 0 || accuracy >= 1 {
+		return DDSketchHistogramSink{}, fmt.Errorf("invalid dds accuracy %g, it must be between 0 and 1 (exclusive)", accuracy)
+	}
+
+	dds, err := ddsketch.NewDefaultDDSketch(accuracy)
+	if err != nil {
+		return DDSketchHistogramSink{}, fmt.Errorf("invalid dds accuracy %g: %w", accuracy, err)
+	}
+
+	return DDSketchHistogramSink{dds: dds}, nil
+}
+
+// newLike instantiates a new empty DDSketchHistogramSink with the same relative accuracy.
+func (d DDSketchHistogramSink) newLike() DDSketchHistogramSink {
+	dds := d.dds.Copy()
+	dds.Clear()
 	return DDSketchHistogramSink{dds: dds}
 }
 
+// compatible returns an error if the given DDSketchHistogramSink
+// has a different relative accuracy, as they cannot be merged (see Compatible).
+func (d DDSketchHistogramSink) compatible(other DDSketchHistogramSink) error {
+	if !d.dds.IndexMapping.Equals(other.dds.IndexMapping) {
+		return fmt.Errorf("%w: dds trend sinks with different accuracies", ErrIncompatibleSinks)
+	}
+	return nil
+}
+
 // IsEmpty indicates whether the TrendSink is empty.
 func (d DDSketchHistogramSink) IsEmpty() bool { return d.dds.GetCount() == 0 }
 
@@ -63,6 +98,34 @@ func (d DDSketchHistogramSink) Avg() float64 {
 	return d.dds.GetSum() / d.dds.GetCount()
 }
 
+// Variance implements the Sink interface, returning the variance of values
+// recorded, approximated from the representative value of each bin.
+func (d DDSketchHistogramSink) Variance() float64 {
+	return varianceOf(d.bins())
+}
+
+// MAD implements the Sink interface, returning the median absolute deviation
+// of values recorded, approximated from the representative value of each bin.
+func (d DDSketchHistogramSink) MAD() float64 {
+	return madOf(d.bins(), d.P(0.5))
+}
+
+// Rank implements the Sink interface, returning the fraction of values recorded lower
+// than or equal to the given one, approximated from the representative value of each bin.
+func (d DDSketchHistogramSink) Rank(value float64) float64 {
+	return rankOf(d.bins(), value, d.Min(), d.Max())
+}
+
+// bins returns the non-empty bins of the sketch.
+func (d DDSketchHistogramSink) bins() []weightedValue {
+	var bins []weightedValue
+	d.dds.ForEach(func(value, count float64) bool {
+		bins = append(bins, weightedValue{value: value, weight: count})
+		return false
+	})
+	return bins
+}
+
 // Format trend and return a map
 func (d DDSketchHistogramSink) Format(_ time.Duration) map[string]float64 {
 	return map[string]float64{
@@ -76,16 +139,42 @@ func (d DDSketchHistogramSink) Format(_ time.Duration) map[string]float64 {
 }
 
 // Merge merges two Sink instances.
-func (d DDSketchHistogramSink) Merge(s Sink) {
+func (d DDSketchHistogramSink) Merge(s Sink) error {
 	toMerge, ok := s.(DDSketchHistogramSink)
 	if !ok {
-		panic("trying to merge incompatible trend sinks")
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, d, s)
 	}
 
-	// FIXME: Handle error
-	_ = d.dds.MergeWith(toMerge.dds)
+	// It fails if the relative accuracy of both sketches doesn't match.
+	if err := d.dds.MergeWith(toMerge.dds); err != nil {
+		return fmt.Errorf("%w: %s", ErrIncompatibleSinks, err)
+	}
+
+	return nil
 }
 
 // We want to make sure that the DDSketchHistogramSink
 // implements the TrendSink interface.
 var _ Sink = DDSketchHistogramSink{}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface,
+// by using the DDSketch's protobuf encoding.
+func (d DDSketchHistogramSink) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(d.dds.ToProto())
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (d *DDSketchHistogramSink) UnmarshalBinary(data []byte) error {
+	var pb sketchpb.DDSketch
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return fmt.Errorf("malformed dds trend sink data: %w", err)
+	}
+
+	dds, err := ddsketch.FromProto(&pb)
+	if err != nil {
+		return fmt.Errorf("malformed dds trend sink data: %w", err)
+	}
+
+	d.dds = dds
+	return nil
+}
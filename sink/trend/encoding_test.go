@@ -0,0 +1,157 @@
+package trend
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+func TestSinkRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	newAdaptive := func(maxCount uint64) func() Sink {
+		return func() Sink {
+			s, err := NewAdaptiveSink(maxCount, 0, DefaultSinkConfig(sinkTypeDDS))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+	}
+
+	// Some encodings aren't completely lossless: the t-digest one stores the centroid means
+	// as float32, and the DDSketch one rebuilds its index mapping from its gamma. Also, some
+	// stats are summed up in a different order once decoded (e.g. from maps and heaps).
+	// Anyway, the differences are negligible compared to the accuracy of those sinks.
+	const (
+		lossless  = 0
+		reordered = 1e-12
+		lossy     = 1e-5
+	)
+
+	for _, tc := range []struct {
+		name      string
+		newSink   func() Sink
+		tolerance float64
+	}{
+		{name: "k6", newSink: func() Sink { return NewK6Sink() }, tolerance: lossless},
+		{name: "hdr", newSink: func() Sink { return NewHdrHistogramSink() }, tolerance: lossless},
+		{name: "dds", newSink: func() Sink { return NewDDSketchHistogramSink() }, tolerance: lossy},
+		{name: "tdigest", newSink: func() Sink { return NewTDigestSink() }, tolerance: lossy},
+		{name: "reservoir", newSink: func() Sink { return NewReservoirSink() }, tolerance: reordered},
+		{name: "circllhist", newSink: func() Sink { return NewCircllhistSink() }, tolerance: reordered},
+		{name: "adaptive (exact)", newSink: newAdaptive(1_000_000), tolerance: lossless},
+		{name: "adaptive (converted)", newSink: newAdaptive(100), tolerance: lossy},
+		{name: "checked", newSink: func() Sink { return NewCheckedSink(NewDDSketchHistogramSink()) }, tolerance: lossy},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, count := range []int{0, 1, 1000} {
+				s := tc.newSink()
+				addValues(s, count)
+
+				data, err := Marshal(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := Unmarshal(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if reflect.TypeOf(got) != reflect.TypeOf(s) {
+					t.Fatalf("count=%d: expected a %T, got a %T", count, s, got)
+				}
+				assertSameStats(t, s, got, tc.tolerance)
+
+				// Both must keep recording values the same way.
+				addValues(s, 10)
+				addValues(got, 10)
+				assertSameStats(t, s, got, tc.tolerance)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range [][]byte{
+		nil,
+		{5, 'k'},
+		[]byte("\x07unknown"),
+		[]byte("\x02k6\x01\x02\x03"),
+	} {
+		if _, err := Unmarshal(data); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+// addValues adds the given number of (deterministic) pseudo-random values to the given sink.
+func addValues(s Sink, count int) {
+	r := rand.New(rand.NewSource(int64(count)))
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < count; i++ {
+		s.Add(metrics.Sample{Value: 1 + r.ExpFloat64()*100, Time: start.Add(time.Duration(i) * time.Millisecond)})
+	}
+}
+
+// assertSameStats checks that both sinks have the same values for every stat,
+// up to the given relative tolerance (absolute, for values lower than one).
+func assertSameStats(t *testing.T, want, got Sink, tolerance float64) {
+	t.Helper()
+
+	stats := map[string]func(Sink) float64{
+		"count":    func(s Sink) float64 { return float64(s.Count()) },
+		"min":      Sink.Min,
+		"max":      Sink.Max,
+		"avg":      Sink.Avg,
+		"variance": Sink.Variance,
+		"mad":      Sink.MAD,
+		"empty": func(s Sink) float64 {
+			if s.IsEmpty() {
+				return 1
+			}
+			return 0
+		},
+	}
+	for _, pct := range []float64{0, 0.25, 0.5, 0.9, 0.95, 0.99, 1} {
+		pct := pct
+		stats["p("+strconv.FormatFloat(pct*100, 'g', -1, 64)+")"] = func(s Sink) float64 { return s.P(pct) }
+	}
+	for _, value := range []float64{0, 10, 50, 100, 1000} {
+		value := value
+		stats["pr("+strconv.FormatFloat(value, 'g', -1, 64)+")"] = func(s Sink) float64 { return s.Rank(value) }
+	}
+
+	for stat, get := range stats {
+		if w, g := get(want), get(got); !almostEqual(w, g, tolerance) {
+			t.Errorf("%s: expected %v, got %v", stat, w, g)
+		}
+	}
+
+	wantFormat, gotFormat := want.Format(time.Second), got.Format(time.Second)
+	if len(wantFormat) != len(gotFormat) {
+		t.Fatalf("format: expected %v, got %v", wantFormat, gotFormat)
+	}
+	for stat, w := range wantFormat {
+		if g, ok := gotFormat[stat]; !ok || !almostEqual(w, g, tolerance) {
+			t.Errorf("format %s: expected %v, got %v", stat, w, g)
+		}
+	}
+}
+
+func almostEqual(want, got, tolerance float64) bool {
+	if math.IsNaN(want) || math.IsNaN(got) {
+		return math.IsNaN(want) && math.IsNaN(got)
+	}
+	return math.Abs(want-got) <= tolerance*math.Max(1, math.Abs(want))
+}
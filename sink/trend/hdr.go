@@ -1,6 +1,10 @@
 package trend
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/HdrHistogram/hdrhistogram-go"
@@ -11,45 +15,121 @@ import (
 // HdrHistogramSink is a Sink implementation that relies
 // on a HdrHistogram under that hood. So, it is less accurate
 // but also has less impact in terms of memory allocations.
+//
+// As HdrHistogram only records integers, values are multiplied by a
+// scale factor before being recorded (e.g. 1000 to keep microseconds
+// precision for time values, in milliseconds), and divided back when
+// they are reported, so they are always in the original unit.
 type HdrHistogramSink struct {
-	hdr *hdrhistogram.Histogram
+	hdr   *hdrhistogram.Histogram
+	scale float64
+
+	// outOfRange counts the values that couldn't be recorded
+	// because they are out of the range of the histogram.
+	// It's a pointer because the sink is used by value.
+	outOfRange *uint64
 }
 
 // NewHdrHistogramSink instantiates a new HdrHistogramSink
 // with values between [1, 100000000000] with the number
-// of significant value digits up to 5.
+// of significant value digits up to 5, and no scale.
 func NewHdrHistogramSink() HdrHistogramSink {
 	return HdrHistogramSink{
 		hdr: hdrhistogram.New(
-			1,
-			100000000000,
-			5,
+			defaultHdrLowest,
+			defaultHdrHighest,
+			defaultHdrDigits,
 		),
+		scale:      1,
+		outOfRange: new(uint64),
+	}
+}
+
+// NewHdrHistogramSinkWith instantiates a new HdrHistogramSink with values
+// between [lowest, highest] with the given number of significant value digits,
+// where the range applies to the values once multiplied by the given scale.
+// It returns an error if the parameters are out of the supported ranges.
+func NewHdrHistogramSinkWith(lowest, highest int64, digits int, scale float64) (HdrHistogramSink, error) {
+	if lowest < 1 {
+		return HdrHistogramSink{}, fmt.Errorf("invalid hdr lowest value %d, it must be greater than or equal to 1", lowest)
+	}
+	if highest < 2*lowest {
+		return HdrHistogramSink{}, fmt.Errorf("invalid hdr highest value %d, it must be at least twice the lowest (%d)", highest, lowest)
+	}
+	if digits < 1 || digits > 5 {
+		return HdrHistogramSink{}, fmt.Errorf("invalid hdr significant digits %d, it must be between 1 and 5", digits)
+	}
+	if scale <= 0 || math.IsInf(scale, 0) || math.IsNaN(scale) {
+		return HdrHistogramSink{}, fmt.Errorf("invalid hdr scale %g, it must be greater than 0", scale)
 	}
+
+	return HdrHistogramSink{
+		hdr:        hdrhistogram.New(lowest, highest, digits),
+		scale:      scale,
+		outOfRange: new(uint64),
+	}, nil
+}
+
+// newLike instantiates a new empty HdrHistogramSink with the same parameters.
+func (h HdrHistogramSink) newLike() HdrHistogramSink {
+	return HdrHistogramSink{
+		hdr: hdrhistogram.New(
+			h.hdr.LowestTrackableValue(),
+			h.hdr.HighestTrackableValue(),
+			int(h.hdr.SignificantFigures()),
+		),
+		scale:      h.scale,
+		outOfRange: new(uint64),
+	}
+}
+
+// compatible returns an error if the given HdrHistogramSink has different parameters,
+// as merging them would drop the values out of range, or lose precision (see Compatible).
+func (h HdrHistogramSink) compatible(other HdrHistogramSink) error {
+	if h.hdr.LowestTrackableValue() != other.hdr.LowestTrackableValue() ||
+		h.hdr.HighestTrackableValue() != other.hdr.HighestTrackableValue() ||
+		h.hdr.SignificantFigures() != other.hdr.SignificantFigures() ||
+		h.scale != other.scale {
+		return fmt.Errorf("%w: hdr trend sinks with different parameters", ErrIncompatibleSinks)
+	}
+	return nil
 }
 
 // IsEmpty indicates whether the TrendSink is empty.
 func (h HdrHistogramSink) IsEmpty() bool { return h.hdr.TotalCount() == 0 }
 
 // Add implements the Sink interface, recording the value of the given metrics.Sample.
+// Values out of the range of the histogram are not recorded, but counted (see OutOfRange).
 func (h HdrHistogramSink) Add(s metrics.Sample) {
-	// FIXME: Handle error
-	_ = h.hdr.RecordValue(int64(s.Value))
+	if err := h.hdr.RecordValue(int64(math.Round(s.Value * h.scale))); err != nil {
+		*h.outOfRange++
+	}
+}
+
+// OutOfRange returns the number of values that couldn't be
+// recorded because they are out of the range of the histogram.
+func (h HdrHistogramSink) OutOfRange() uint64 {
+	return *h.outOfRange
+}
+
+// Range returns the range of values that can be recorded, in the original unit.
+func (h HdrHistogramSink) Range() (lowest, highest float64) {
+	return float64(h.hdr.LowestTrackableValue()) / h.scale, float64(h.hdr.HighestTrackableValue()) / h.scale
 }
 
 // P implements the Sink interface, returning the value at percentile.
 func (h HdrHistogramSink) P(pct float64) float64 {
-	return float64(h.hdr.ValueAtPercentile(pct * 100.0))
+	return float64(h.hdr.ValueAtPercentile(pct*100.0)) / h.scale
 }
 
 // Min implements the Sink interface, returning the minimum value recorded.
 func (h HdrHistogramSink) Min() float64 {
-	return float64(h.hdr.Min())
+	return float64(h.hdr.Min()) / h.scale
 }
 
 // Max implements the Sink interface, returning the maximum value recorded.
 func (h HdrHistogramSink) Max() float64 {
-	return float64(h.hdr.Max())
+	return float64(h.hdr.Max()) / h.scale
 }
 
 // Count implements the Sink interface, returning the total amount of values recorded.
@@ -59,7 +139,38 @@ func (h HdrHistogramSink) Count() uint64 {
 
 // Avg implements the Sink interface, returning the average (mean) of values recorded.
 func (h HdrHistogramSink) Avg() float64 {
-	return h.hdr.Mean()
+	return h.hdr.Mean() / h.scale
+}
+
+// Variance implements the Sink interface, returning the variance of values
+// recorded, approximated from the middle value of each bucket.
+func (h HdrHistogramSink) Variance() float64 {
+	return varianceOf(h.buckets())
+}
+
+// MAD implements the Sink interface, returning the median absolute deviation
+// of values recorded, approximated from the middle value of each bucket.
+func (h HdrHistogramSink) MAD() float64 {
+	return madOf(h.buckets(), h.P(0.5))
+}
+
+// Rank implements the Sink interface, returning the fraction of values recorded lower
+// than or equal to the given one, approximated from the middle value of each bucket.
+func (h HdrHistogramSink) Rank(value float64) float64 {
+	return rankOf(h.buckets(), value, h.Min(), h.Max())
+}
+
+// buckets returns the non-empty buckets of the histogram, in the original unit.
+func (h HdrHistogramSink) buckets() []weightedValue {
+	var buckets []weightedValue
+	for _, bar := range h.hdr.Distribution() {
+		if bar.Count == 0 {
+			continue
+		}
+		middle := (float64(bar.From) + float64(bar.To)) / 2
+		buckets = append(buckets, weightedValue{value: middle / h.scale, weight: float64(bar.Count)})
+	}
+	return buckets
 }
 
 // Format trend and return a map
@@ -75,16 +186,76 @@ func (h HdrHistogramSink) Format(_ time.Duration) map[string]float64 {
 }
 
 // Merge merges two Sink instances.
-func (h HdrHistogramSink) Merge(s Sink) {
+// It returns an error if their scales don't match, or if any of the
+// values couldn't be merged, because they are out of the range of the
+// current histogram (in which case they are also counted as out of range).
+func (h HdrHistogramSink) Merge(s Sink) error {
 	toMerge, ok := s.(HdrHistogramSink)
 	if !ok {
-		panic("trying to merge incompatible trend sinks")
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, h, s)
+	}
+
+	if h.scale != toMerge.scale {
+		return fmt.Errorf("%w: hdr trend sinks with different scales (%g and %g)",
+			ErrIncompatibleSinks, h.scale, toMerge.scale)
 	}
 
-	// FIXME: Handle error
-	_ = h.hdr.Merge(toMerge.hdr)
+	*h.outOfRange += *toMerge.outOfRange
+
+	if dropped := h.hdr.Merge(toMerge.hdr); dropped > 0 {
+		*h.outOfRange += uint64(dropped)
+		return fmt.Errorf("%d values dropped while merging hdr trend sinks, out of range", dropped)
+	}
+
+	return nil
 }
 
 // We want to make sure that the HdrHistogramSink
 // implements the Sink interface.
 var _ Sink = HdrHistogramSink{}
+
+// hdrSinkHeader is the fixed-size part of the encoded
+// HdrHistogramSink, followed by the encoded histogram.
+type hdrSinkHeader struct {
+	Scale      float64
+	OutOfRange uint64
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface,
+// by using the HdrHistogram's V2 compressed encoding, preceded
+// by the scale and the count of values out of range.
+func (h HdrHistogramSink) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	header := hdrSinkHeader{Scale: h.scale, OutOfRange: *h.outOfRange}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+
+	data, err := h.hdr.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf.Bytes(), data...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (h *HdrHistogramSink) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var header hdrSinkHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("malformed hdr trend sink data: %w", err)
+	}
+	if header.Scale <= 0 {
+		return fmt.Errorf("malformed hdr trend sink data: invalid scale %g", header.Scale)
+	}
+
+	hdr, err := hdrhistogram.Decode(data[len(data)-r.Len():])
+	if err != nil {
+		return fmt.Errorf("malformed hdr trend sink data: %w", err)
+	}
+
+	h.hdr, h.scale, h.outOfRange = hdr, header.Scale, &header.OutOfRange
+	return nil
+}
@@ -1,6 +1,9 @@
 package trend
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"math"
 	"sort"
 	"time"
@@ -10,7 +13,8 @@ import (
 
 // Code copied (and slightly modified) from: https://github.com/grafana/k6/blob/master/metrics/sink.go.
 
-// NewK6Sink makes a Trend sink with the OpenHistogram circllhist histogram.
+// NewK6Sink makes a Trend sink that keeps all the values, so the stats are exact.
+// See CircllhistSink for a Trend sink with the OpenHistogram circllhist histogram.
 func NewK6Sink() *K6Sink {
 	return &K6Sink{}
 }
@@ -20,6 +24,11 @@ type K6Sink struct {
 	values []float64
 	sorted bool
 
+	// runs, if set, are the sorted values of the sinks this one was merged from,
+	// shared with them, instead of the values (see mergeK6Sinks). They are only
+	// read, and merged into the values once the sink is modified (see own).
+	runs [][]float64
+
 	count    uint64
 	min, max float64
 	sum      float64
@@ -30,6 +39,8 @@ func (t *K6Sink) IsEmpty() bool { return t.count == 0 }
 
 // Add a single sample into the trend
 func (t *K6Sink) Add(s metrics.Sample) {
+	t.own()
+
 	if t.count == 0 {
 		t.max, t.min = s.Value, s.Value
 	} else {
@@ -53,24 +64,45 @@ func (t *K6Sink) P(pct float64) float64 {
 	case 0:
 		return 0
 	case 1:
-		return t.values[0]
+		return t.nth(0)
 	default:
-		if !t.sorted {
-			sort.Float64s(t.values)
-			t.sorted = true
-		}
+		t.Sort()
 
 		// If percentile falls on a value in Values slice, we return that value.
 		// If percentile does not fall on a value in Values slice, we calculate (linear interpolation)
 		// the value that would fall at percentile, given the values above and below that percentile.
 		i := pct * (float64(t.count) - 1.0)
-		j := t.values[int(math.Floor(i))]
-		k := t.values[int(math.Ceil(i))]
+		j := t.nth(uint64(math.Floor(i)))
+		k := t.nth(uint64(math.Ceil(i)))
 		f := i - math.Floor(i)
 		return j + (k-j)*f
 	}
 }
 
+// PInterval returns the confidence interval of the given percentile, for the given
+// confidence level (e.g. 0.95). It is a distribution-free interval, built from the
+// order statistics (i.e. the sorted values) around the rank of the percentile, with
+// the normal approximation of the binomial distribution of that rank.
+func (t *K6Sink) PInterval(pct, level float64) (lower, upper float64) {
+	if t.count == 0 {
+		return 0, 0
+	}
+
+	t.Sort()
+
+	n := float64(t.count)
+	z := math.Sqrt2 * math.Erfinv(level)
+	margin := z * math.Sqrt(n*pct*(1-pct))
+
+	// Ranks are 1-based, so they're converted
+	// into indexes, within the range of values.
+	index := func(rank float64) uint64 {
+		return uint64(math.Min(math.Max(rank, 1), n)) - 1
+	}
+
+	return t.nth(index(math.Floor(n*pct - margin))), t.nth(index(math.Ceil(n*pct + margin)))
+}
+
 // Min returns the minimum value.
 func (t *K6Sink) Min() float64 {
 	return t.min
@@ -94,6 +126,49 @@ func (t *K6Sink) Avg() float64 {
 	return 0
 }
 
+// Variance returns the (population) variance of the values.
+func (t *K6Sink) Variance() float64 {
+	if t.count == 0 {
+		return 0
+	}
+
+	mean := t.Avg()
+
+	var squares float64
+	t.each(func(v float64) {
+		squares += (v - mean) * (v - mean)
+	})
+
+	return squares / float64(t.count)
+}
+
+// MAD returns the median absolute deviation of the values.
+func (t *K6Sink) MAD() float64 {
+	if t.count == 0 {
+		return 0
+	}
+
+	median := t.P(0.5)
+
+	deviations := &K6Sink{values: make([]float64, 0, t.count), count: t.count}
+	t.each(func(v float64) {
+		deviations.values = append(deviations.values, math.Abs(v-median))
+	})
+
+	return deviations.P(0.5)
+}
+
+// Rank returns the fraction of values lower than or equal to the given one.
+func (t *K6Sink) Rank(value float64) float64 {
+	if t.count == 0 {
+		return 0
+	}
+
+	t.Sort()
+
+	return float64(t.countUpTo(value)) / float64(t.count)
+}
+
 // Format trend and return a map
 func (t *K6Sink) Format(_ time.Duration) map[string]float64 {
 	return map[string]float64{
@@ -107,17 +182,310 @@ func (t *K6Sink) Format(_ time.Duration) map[string]float64 {
 }
 
 // Merge merges two Sink instances.
-func (t *K6Sink) Merge(s Sink) {
+//
+// The given sink is never modified, so it is safe to merge the same
+// sink into multiple ones concurrently. If both sinks are already
+// sorted, their values are merged preserving the order, so the
+// percentiles of the merged sink don't require sorting them again.
+func (t *K6Sink) Merge(s Sink) error {
 	toMerge, ok := s.(*K6Sink)
 	if !ok {
-		panic("trying to merge incompatible trend sinks")
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, t, s)
+	}
+
+	if toMerge.count == 0 {
+		return nil
+	}
+
+	t.own()
+
+	switch {
+	case t.count == 0 && toMerge.runs != nil:
+		t.values = mergeRuns(toMerge.runs)
+		t.sorted = true
+		t.min, t.max = toMerge.min, toMerge.max
+	case t.count == 0:
+		t.values = append(make([]float64, 0, len(toMerge.values)), toMerge.values...)
+		t.sorted = toMerge.sorted
+		t.min, t.max = toMerge.min, toMerge.max
+	case t.sorted && toMerge.sorted:
+		t.values = mergeSortedInto(t.values, toMerge.sortedValues())
+		t.min, t.max = math.Min(t.min, toMerge.min), math.Max(t.max, toMerge.max)
+	default:
+		t.values = append(t.values, toMerge.sortedValues()...)
+		t.sorted = false
+		t.min, t.max = math.Min(t.min, toMerge.min), math.Max(t.max, toMerge.max)
+	}
+
+	t.count += toMerge.count
+	t.sum += toMerge.sum
+
+	return nil
+}
+
+// Sort sorts the values of the sink, if they aren't already, like calculating
+// any percentile does. Then, the sinks merged from it don't need to copy and sort
+// them again (see mergeK6Sinks), as long as no more values are added into it.
+func (t *K6Sink) Sort() {
+	if !t.sorted {
+		sort.Float64s(t.values)
+		t.sorted = true
+	}
+}
+
+// mergeK6Sinks merges all the given sinks into a new one, at once, with a
+// single allocation or, if all of them are already sorted (see Sort), without
+// copying their values: the merged sink keeps them as sorted runs, and its stats
+// are calculated across them (e.g. the percentiles, see K6Sink.nth), until it is
+// modified. So, the given sinks are not modified, but they must not be while
+// the merged one is in use.
+func mergeK6Sinks(sinks []*K6Sink) *K6Sink {
+	merged := NewK6Sink()
+
+	var (
+		allSorted = true
+		runs      = make([][]float64, 0, len(sinks))
+	)
+	for _, s := range sinks {
+		if s.count == 0 {
+			continue
+		}
+
+		if merged.count == 0 {
+			merged.min, merged.max = s.min, s.max
+		} else {
+			merged.min, merged.max = math.Min(merged.min, s.min), math.Max(merged.max, s.max)
+		}
+		merged.count += s.count
+		merged.sum += s.sum
+
+		allSorted = allSorted && s.sorted
+		if s.runs != nil {
+			// It is a merged sink too, so its runs are merged along with the rest.
+			runs = append(runs, s.runs...)
+		} else {
+			runs = append(runs, s.values)
+		}
+	}
+
+	if len(runs) == 0 {
+		return merged
+	}
+
+	if !allSorted {
+		// Values are copied, because the given sinks must not be modified.
+		merged.values = make([]float64, 0, merged.count)
+		for _, run := range runs {
+			merged.values = append(merged.values, run...)
+		}
+		return merged
 	}
 
-	for _, v := range toMerge.values {
-		t.Add(metrics.Sample{Value: v})
+	merged.runs = runs
+	merged.sorted = true
+
+	return merged
+}
+
+// mergeRuns merges the given sorted runs into a new sorted slice,
+// by pairs, like a merge sort, until there's only one left.
+func mergeRuns(runs [][]float64) []float64 {
+	runs = append(make([][]float64, 0, len(runs)), runs...)
+	for len(runs) > 1 {
+		next := runs[:0]
+		for i := 0; i < len(runs); i += 2 {
+			if i+1 == len(runs) {
+				next = append(next, runs[i])
+				continue
+			}
+			next = append(next, mergeSorted(runs[i], runs[i+1]))
+		}
+		runs = next
+	}
+
+	if len(runs) == 1 {
+		return runs[0]
+	}
+	return nil
+}
+
+// own merges the runs shared with other sinks, if any, into the values
+// of the sink, so it can be modified without modifying the other ones.
+func (t *K6Sink) own() {
+	if t.runs == nil {
+		return
+	}
+
+	t.values = mergeRuns(t.runs)
+	t.runs = nil
+}
+
+// sortedValues returns the values of the sink, merging its runs, if any,
+// without modifying it. So, the returned slice must not be modified either.
+func (t *K6Sink) sortedValues() []float64 {
+	if t.runs != nil {
+		return mergeRuns(t.runs)
+	}
+	return t.values
+}
+
+// each calls the given function with each one of the values,
+// either from the values of the sink or from its runs, in no particular order.
+func (t *K6Sink) each(fn func(float64)) {
+	if t.runs == nil {
+		for _, v := range t.values {
+			fn(v)
+		}
+		return
+	}
+
+	for _, run := range t.runs {
+		for _, v := range run {
+			fn(v)
+		}
+	}
+}
+
+// countUpTo returns the number of values lower than or equal to the given one.
+// The sink must be sorted.
+func (t *K6Sink) countUpTo(value float64) uint64 {
+	if t.runs == nil {
+		// The index of the first value greater than the given one.
+		return uint64(sort.Search(len(t.values), func(i int) bool { return t.values[i] > value }))
+	}
+
+	var count uint64
+	for _, run := range t.runs {
+		count += uint64(sort.Search(len(run), func(i int) bool { return run[i] > value }))
+	}
+	return count
+}
+
+// nth returns the n-th (zero-based) lowest value. The sink must be sorted.
+//
+// If the values are split into sorted runs, it is selected across them without merging them:
+// it is the lowest value with more than n values lower than or equal to it, found by a binary
+// search over the (ordered) bits of the float64 values, between the minimum and the maximum.
+// So, it takes at most 64 iterations, each one with a binary search over each run.
+func (t *K6Sink) nth(n uint64) float64 {
+	if t.runs == nil {
+		return t.values[n]
+	}
+
+	lo, hi := orderedBits(t.min), orderedBits(t.max)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if t.countUpTo(fromOrderedBits(mid)) > n {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return fromOrderedBits(lo)
+}
+
+// orderedBits maps the given float64 into an uint64, preserving their order.
+func orderedBits(f float64) uint64 {
+	bits := math.Float64bits(f)
+	if bits>>63 == 1 {
+		return ^bits
+	}
+	return bits | 1<<63
+}
+
+// fromOrderedBits is the inverse of orderedBits.
+func fromOrderedBits(bits uint64) float64 {
+	if bits>>63 == 1 {
+		return math.Float64frombits(bits &^ (1 << 63))
+	}
+	return math.Float64frombits(^bits)
+}
+
+// mergeSorted merges two sorted slices into a new sorted one.
+func mergeSorted(a, b []float64) []float64 {
+	merged := make([]float64, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] <= b[j] {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
+}
+
+// mergeSortedInto merges the sorted slice b into the sorted slice a, in place (from the
+// end, so no value is overwritten before being moved), growing a as needed, like append.
+func mergeSortedInto(a, b []float64) []float64 {
+	i, j := len(a)-1, len(b)-1
+	a = append(a, b...)
+	for k := len(a) - 1; j >= 0; k-- {
+		if i >= 0 && a[i] > b[j] {
+			a[k] = a[i]
+			i--
+		} else {
+			a[k] = b[j]
+			j--
+		}
 	}
+	return a
 }
 
 // We want to make sure that the K6Sink
 // implements the Sink interface.
 var _ Sink = &K6Sink{}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (t *K6Sink) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	header := k6SinkHeader{Count: t.count, Min: t.min, Max: t.max, Sum: t.sum, Sorted: t.sorted}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, t.sortedValues()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (t *K6Sink) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var header k6SinkHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("malformed k6 trend sink data: %w", err)
+	}
+	// The count is checked against the remaining length, instead of
+	// the other way around, so a corrupted count cannot overflow.
+	if uint64(r.Len())%8 != 0 || header.Count != uint64(r.Len())/8 {
+		return fmt.Errorf("malformed k6 trend sink data: expected %d values", header.Count)
+	}
+
+	values := make([]float64, header.Count)
+	if err := binary.Read(r, binary.LittleEndian, values); err != nil {
+		return fmt.Errorf("malformed k6 trend sink data: %w", err)
+	}
+
+	*t = K6Sink{
+		values: values,
+		sorted: header.Sorted,
+		count:  header.Count,
+		min:    header.Min,
+		max:    header.Max,
+		sum:    header.Sum,
+	}
+	return nil
+}
+
+// k6SinkHeader holds the fixed-size fields of a K6Sink, used for encoding.
+type k6SinkHeader struct {
+	Count    uint64
+	Min, Max float64
+	Sum      float64
+	Sorted   bool
+}
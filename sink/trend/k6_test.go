@@ -0,0 +1,257 @@
+package trend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"go.k6.io/k6/metrics"
+)
+
+func TestK6SinkSort(t *testing.T) {
+	t.Parallel()
+
+	// The variance is added up in a different order once sorted.
+	const reordered = 1e-12
+
+	s, want := NewK6Sink(), NewK6Sink()
+	r := rand.New(rand.NewSource(1))
+	for batch := 0; batch < 5; batch++ {
+		for i := 0; i < 100; i++ {
+			v := float64(r.Intn(200) - 50)
+			s.Add(metrics.Sample{Value: v})
+			want.Add(metrics.Sample{Value: v})
+		}
+
+		s.Sort()
+		if !s.sorted || !sort.Float64sAreSorted(s.values) {
+			t.Fatalf("batch %d: expected the values to be sorted", batch)
+		}
+		assertSameStats(t, want, s, reordered)
+	}
+
+	// The values merged into a sorted sink are sorted along with the rest.
+	other := NewK6Sink()
+	addValues(other, 100)
+	if err := s.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := want.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Sort()
+	if !sort.Float64sAreSorted(s.values) {
+		t.Fatal("expected the merged values to be sorted")
+	}
+	assertSameStats(t, want, s, reordered)
+}
+
+func TestMergeK6SinksSortedRuns(t *testing.T) {
+	t.Parallel()
+
+	r := rand.New(rand.NewSource(1))
+
+	// Values are rounded, so there are plenty of ties, within and across the sinks.
+	sinks := make([]*K6Sink, 5)
+	for i := range sinks {
+		sinks[i] = NewK6Sink()
+		for j := 0; j < 100*(i+1); j++ {
+			sinks[i].Add(metrics.Sample{Value: float64(r.Intn(200) - 50)})
+		}
+		sinks[i].Sort()
+	}
+
+	merged := mergeK6Sinks(sinks)
+	if merged.runs == nil {
+		t.Fatal("expected the sorted sinks to be merged as runs")
+	}
+
+	// The same values, merged one by one.
+	want := NewK6Sink()
+	for _, s := range sinks {
+		for _, v := range s.values {
+			want.Add(metrics.Sample{Value: v})
+		}
+	}
+
+	// The sum is added up in a different order, so the average may differ slightly.
+	const reordered = 1e-12
+
+	assertSameStats(t, want, merged, reordered)
+
+	// A merged sink can be merged again, along with its runs.
+	extra := NewK6Sink()
+	extra.Add(metrics.Sample{Value: 1000})
+	extra.Sort()
+	want.Add(metrics.Sample{Value: 1000})
+
+	remerged := mergeK6Sinks([]*K6Sink{merged, extra})
+	if len(remerged.runs) != len(sinks)+1 {
+		t.Fatalf("expected %d runs, got %d", len(sinks)+1, len(remerged.runs))
+	}
+	assertSameStats(t, want, remerged, reordered)
+
+	// Once modified, the merged sink must stop sharing the values of the given ones.
+	before := append([]float64(nil), sinks[0].values...)
+	merged.Add(metrics.Sample{Value: -1000})
+	if merged.runs != nil {
+		t.Fatal("expected the runs to be merged into the values once modified")
+	}
+	for i, v := range sinks[0].values {
+		if v != before[i] {
+			t.Fatal("expected the given sinks not to be modified")
+		}
+	}
+}
+
+func TestMergeK6SinksUnsorted(t *testing.T) {
+	t.Parallel()
+
+	a, b := NewK6Sink(), NewK6Sink()
+	addValues(a, 100)
+	addValues(b, 10)
+	b.Sort()
+
+	// As soon as one of them isn't sorted, the values are copied into a new slice.
+	merged := mergeK6Sinks([]*K6Sink{a, b, mergeK6Sinks([]*K6Sink{b})})
+	if merged.runs != nil || merged.sorted {
+		t.Fatal("expected the values to be copied, unsorted")
+	}
+
+	want := NewK6Sink()
+	for _, s := range []*K6Sink{a, b, b} {
+		if err := want.Merge(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertSameStats(t, want, merged, 1e-12)
+}
+
+func TestK6SinkMergeFromRuns(t *testing.T) {
+	t.Parallel()
+
+	a, b := NewK6Sink(), NewK6Sink()
+	for i := 0; i < 10; i++ {
+		a.Add(metrics.Sample{Value: float64(i)})
+		b.Add(metrics.Sample{Value: float64(10 - i)})
+	}
+	a.Sort()
+	b.Sort()
+
+	runs := mergeK6Sinks([]*K6Sink{a, b})
+
+	for _, into := range []*K6Sink{NewK6Sink(), mergeK6Sinks([]*K6Sink{b})} {
+		if err := into.Merge(runs); err != nil {
+			t.Fatal(err)
+		}
+		if into.runs != nil || !into.sorted {
+			t.Fatal("expected the runs to be merged into the sorted values")
+		}
+	}
+
+	got, err := Unmarshal(mustMarshal(t, runs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameStats(t, runs, got, 0)
+}
+
+func TestK6SinkUnmarshalMalformed(t *testing.T) {
+	t.Parallel()
+
+	encode := func(count uint64, values ...float64) []byte {
+		var buf bytes.Buffer
+		_ = binary.Write(&buf, binary.LittleEndian, k6SinkHeader{Count: count})
+		_ = binary.Write(&buf, binary.LittleEndian, values)
+		return buf.Bytes()
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated header": encode(1, 1)[:10],
+		"missing values":   encode(3, 1, 2),
+		"extra values":     encode(1, 1, 2),
+		"partial value":    encode(1, 1)[:len(encode(1, 1))-1],
+		// 1<<61 values would take 0 bytes if the length overflowed.
+		"overflowing count": encode(1 << 61),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var s K6Sink
+			if err := s.UnmarshalBinary(data); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+// BenchmarkK6SinkMerge compares merging k6 sinks, and calculating their stats,
+// by adding every value one by one (how they used to be merged), merging them
+// one by one with Merge, and merging them all at once with MergeAll. The sinks
+// are either unsorted, like the ones being collected by the output, or sorted,
+// like the ones in the snapshots (see Sort).
+func BenchmarkK6SinkMerge(b *testing.B) {
+	for _, sorted := range []bool{false, true} {
+		for _, count := range []int{10, 100} {
+			sinks := make([]Sink, count)
+			for i := range sinks {
+				s := NewK6Sink()
+				addValues(s, 1_000_000/count)
+				if sorted {
+					s.Sort()
+				}
+				sinks[i] = s
+			}
+
+			name := "sorted=" + strconv.FormatBool(sorted) + "/sinks=" + strconv.Itoa(count)
+
+			b.Run(name+"/add", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					merged := NewK6Sink()
+					for _, s := range sinks {
+						for _, v := range s.(*K6Sink).values {
+							merged.Add(metrics.Sample{Value: v})
+						}
+					}
+					merged.Format(0)
+				}
+			})
+
+			b.Run(name+"/merge", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					merged := NewK6Sink()
+					for _, s := range sinks {
+						if err := merged.Merge(s); err != nil {
+							b.Fatal(err)
+						}
+					}
+					merged.Format(0)
+				}
+			})
+
+			b.Run(name+"/merge-all", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					merged, err := MergeAll(sinks...)
+					if err != nil {
+						b.Fatal(err)
+					}
+					merged.Format(0)
+				}
+			})
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, s Sink) []byte {
+	t.Helper()
+
+	data, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
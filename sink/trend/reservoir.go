@@ -0,0 +1,315 @@
+package trend
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// ReservoirSink is a Sink implementation that keeps the exact count,
+// min, max and sum, but only a fixed-size uniform sample (reservoir)
+// of the values to calculate the percentiles. So, it has a predictable
+// memory ceiling, no matter how many values are recorded.
+//
+// Each value gets a random priority, and the reservoir keeps the ones
+// with the highest priorities, so it is a uniform sample of all the
+// recorded values, even after merging multiple reservoirs.
+type ReservoirSink struct {
+	size      int
+	reservoir reservoir
+
+	// sorted caches the reservoir values, sorted,
+	// until a new value is added into the reservoir.
+	sorted []float64
+
+	count    uint64
+	min, max float64
+	sum      float64
+}
+
+// NewReservoirSink instantiates a new ReservoirSink with a reservoir of 10000 values.
+func NewReservoirSink() *ReservoirSink {
+	// The default size is valid,
+	// so the error can be safely ignored.
+	s, _ := NewReservoirSinkWith(defaultReservoirSize)
+	return s
+}
+
+// NewReservoirSinkWith instantiates a new ReservoirSink with a reservoir
+// of the given size. It returns an error if it isn't greater than zero.
+func NewReservoirSinkWith(size int) (*ReservoirSink, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("invalid reservoir size %d, it must be greater than 0", size)
+	}
+	return &ReservoirSink{size: size}, nil
+}
+
+// newLike instantiates a new empty ReservoirSink with the same size.
+func (r *ReservoirSink) newLike() *ReservoirSink {
+	return &ReservoirSink{size: r.size}
+}
+
+// compatible returns an error if the given ReservoirSink has a different size, as the
+// merged reservoir wouldn't be a uniform sample of the same size as any of them (see Compatible).
+func (r *ReservoirSink) compatible(other *ReservoirSink) error {
+	if r.size != other.size {
+		return fmt.Errorf("%w: reservoir trend sinks with different sizes (%d and %d)",
+			ErrIncompatibleSinks, r.size, other.size)
+	}
+	return nil
+}
+
+// IsEmpty indicates whether the TrendSink is empty.
+func (r *ReservoirSink) IsEmpty() bool { return r.count == 0 }
+
+// Add implements the Sink interface, recording the value of the given metrics.Sample.
+func (r *ReservoirSink) Add(s metrics.Sample) {
+	if r.count == 0 {
+		r.min, r.max = s.Value, s.Value
+	} else {
+		r.min, r.max = math.Min(r.min, s.Value), math.Max(r.max, s.Value)
+	}
+	r.count++
+	r.sum += s.Value
+
+	r.offer(reservoirEntry{priority: rand.Float64(), value: s.Value})
+}
+
+// offer adds the entry into the reservoir, if it is not full yet,
+// or if its priority is higher than the lowest one in the reservoir.
+func (r *ReservoirSink) offer(e reservoirEntry) {
+	switch {
+	case len(r.reservoir) < r.size:
+		heap.Push(&r.reservoir, e)
+	case e.priority > r.reservoir[0].priority:
+		r.reservoir[0] = e
+		heap.Fix(&r.reservoir, 0)
+	default:
+		return
+	}
+	r.sorted = nil
+}
+
+// P implements the Sink interface, returning the value at percentile,
+// estimated from the values in the reservoir.
+func (r *ReservoirSink) P(pct float64) float64 {
+	switch len(r.reservoir) {
+	case 0:
+		return 0
+	case 1:
+		return r.reservoir[0].value
+	}
+
+	if r.sorted == nil {
+		r.sorted = make([]float64, len(r.reservoir))
+		for i, e := range r.reservoir {
+			r.sorted[i] = e.value
+		}
+		sort.Float64s(r.sorted)
+	}
+
+	// Same linear interpolation as in K6Sink.
+	i := pct * (float64(len(r.sorted)) - 1.0)
+	j := r.sorted[int(math.Floor(i))]
+	k := r.sorted[int(math.Ceil(i))]
+	f := i - math.Floor(i)
+	return j + (k-j)*f
+}
+
+// Min implements the Sink interface, returning the minimum value recorded.
+func (r *ReservoirSink) Min() float64 {
+	return r.min
+}
+
+// Max implements the Sink interface, returning the maximum value recorded.
+func (r *ReservoirSink) Max() float64 {
+	return r.max
+}
+
+// Count implements the Sink interface, returning the total amount of values recorded.
+func (r *ReservoirSink) Count() uint64 {
+	return r.count
+}
+
+// Avg implements the Sink interface, returning the average (mean) of values recorded.
+func (r *ReservoirSink) Avg() float64 {
+	if r.count > 0 {
+		return r.sum / float64(r.count)
+	}
+	return 0
+}
+
+// Variance implements the Sink interface, returning the variance
+// of values recorded, estimated from the values in the reservoir.
+func (r *ReservoirSink) Variance() float64 {
+	return r.sample().Variance()
+}
+
+// MAD implements the Sink interface, returning the median absolute deviation
+// of values recorded, estimated from the values in the reservoir.
+func (r *ReservoirSink) MAD() float64 {
+	return r.sample().MAD()
+}
+
+// Rank implements the Sink interface, returning the fraction of values recorded lower
+// than or equal to the given one, estimated from the values in the reservoir.
+func (r *ReservoirSink) Rank(value float64) float64 {
+	return r.sample().Rank(value)
+}
+
+// sample returns a *K6Sink with the values in the reservoir.
+func (r *ReservoirSink) sample() *K6Sink {
+	sample := NewK6Sink()
+	for _, e := range r.reservoir {
+		sample.Add(metrics.Sample{Value: e.value})
+	}
+	return sample
+}
+
+// Format trend and return a map
+func (r *ReservoirSink) Format(_ time.Duration) map[string]float64 {
+	return map[string]float64{
+		"min":   r.Min(),
+		"max":   r.Max(),
+		"avg":   r.Avg(),
+		"med":   r.P(0.5),
+		"p(90)": r.P(0.90),
+		"p(95)": r.P(0.95),
+	}
+}
+
+// Merge merges two Sink instances.
+// It returns an error if their sizes don't match.
+func (r *ReservoirSink) Merge(s Sink) error {
+	toMerge, ok := s.(*ReservoirSink)
+	if !ok {
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, r, s)
+	}
+
+	if err := r.compatible(toMerge); err != nil {
+		return err
+	}
+
+	if toMerge.IsEmpty() {
+		return nil
+	}
+
+	if r.IsEmpty() {
+		r.min, r.max = toMerge.min, toMerge.max
+	} else {
+		r.min, r.max = math.Min(r.min, toMerge.min), math.Max(r.max, toMerge.max)
+	}
+	r.count += toMerge.count
+	r.sum += toMerge.sum
+
+	for _, e := range toMerge.reservoir {
+		r.offer(e)
+	}
+
+	return nil
+}
+
+// We want to make sure that the *ReservoirSink
+// implements the Sink interface.
+var _ Sink = &ReservoirSink{}
+
+// reservoirSinkHeader is the fixed-size part of the encoded ReservoirSink,
+// followed by the (priority, value) pairs of the reservoir.
+type reservoirSinkHeader struct {
+	Size     uint64
+	Count    uint64
+	Min, Max float64
+	Sum      float64
+	Len      uint64
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (r *ReservoirSink) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	header := reservoirSinkHeader{
+		Size:  uint64(r.size),
+		Count: r.count,
+		Min:   r.min,
+		Max:   r.max,
+		Sum:   r.sum,
+		Len:   uint64(len(r.reservoir)),
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+
+	pairs := make([]float64, 0, 2*len(r.reservoir))
+	for _, e := range r.reservoir {
+		pairs = append(pairs, e.priority, e.value)
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, pairs); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (r *ReservoirSink) UnmarshalBinary(data []byte) error {
+	rd := bytes.NewReader(data)
+
+	var header reservoirSinkHeader
+	if err := binary.Read(rd, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("malformed reservoir trend sink data: %w", err)
+	}
+	if header.Size == 0 || header.Len > header.Size ||
+		uint64(rd.Len())%16 != 0 || header.Len != uint64(rd.Len())/16 {
+		return fmt.Errorf("malformed reservoir trend sink data: expected %d values", header.Len)
+	}
+
+	pairs := make([]float64, 2*header.Len)
+	if err := binary.Read(rd, binary.LittleEndian, pairs); err != nil {
+		return fmt.Errorf("malformed reservoir trend sink data: %w", err)
+	}
+
+	res := make(reservoir, header.Len)
+	for i := range res {
+		res[i] = reservoirEntry{priority: pairs[2*i], value: pairs[2*i+1]}
+	}
+	heap.Init(&res)
+
+	*r = ReservoirSink{
+		size:      int(header.Size),
+		reservoir: res,
+		count:     header.Count,
+		min:       header.Min,
+		max:       header.Max,
+		sum:       header.Sum,
+	}
+	return nil
+}
+
+// reservoirEntry is a value in the reservoir, along with its random priority.
+type reservoirEntry struct {
+	priority float64
+	value    float64
+}
+
+// reservoir is a min-heap of entries, by priority,
+// that implements the heap.Interface interface.
+type reservoir []reservoirEntry
+
+func (r reservoir) Len() int           { return len(r) }
+func (r reservoir) Less(i, j int) bool { return r[i].priority < r[j].priority }
+func (r reservoir) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+func (r *reservoir) Push(x interface{}) { *r = append(*r, x.(reservoirEntry)) }
+
+func (r *reservoir) Pop() interface{} {
+	old := *r
+	e := old[len(old)-1]
+	*r = old[:len(old)-1]
+	return e
+}
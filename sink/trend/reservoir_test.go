@@ -0,0 +1,105 @@
+package trend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestReservoirSinkAccuracy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not full", func(t *testing.T) {
+		t.Parallel()
+
+		// While the reservoir isn't full, it holds all the values, so it is exact.
+		s, exact := NewReservoirSink(), NewK6Sink()
+		addUniform(s, 1000)
+		addUniform(exact, 1000)
+
+		assertSameStats(t, exact, s, 0)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		t.Parallel()
+
+		// The values are sampled at random, so the rank error is
+		// set to several standard deviations of the p(50) one.
+		s := NewReservoirSink()
+		addUniform(s, 100000)
+
+		if got := len(s.reservoir); got != defaultReservoirSize {
+			t.Errorf("expected %d values in the reservoir, got %d", defaultReservoirSize, got)
+		}
+		assertUniformStats(t, s, 100000, 0.03)
+	})
+}
+
+func TestReservoirSinkMerge(t *testing.T) {
+	t.Parallel()
+
+	s, other := NewReservoirSink(), NewReservoirSink()
+	addUniform(s, 50000)
+	for i := 50001; i <= 100000; i++ {
+		other.Add(sample(float64(i)))
+	}
+
+	if err := s.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+
+	// The merged reservoir must be a uniform sample of both.
+	if got := len(s.reservoir); got != defaultReservoirSize {
+		t.Errorf("expected %d values in the reservoir, got %d", defaultReservoirSize, got)
+	}
+	assertUniformStats(t, s, 100000, 0.03)
+}
+
+func TestReservoirSinkMergeIncompatible(t *testing.T) {
+	t.Parallel()
+
+	other, err := NewReservoirSinkWith(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, toMerge := range map[string]Sink{
+		"different type": NewK6Sink(),
+		"different size": other,
+	} {
+		if err := NewReservoirSink().Merge(toMerge); !errors.Is(err, ErrIncompatibleSinks) {
+			t.Errorf("%s: expected %v, got %v", name, ErrIncompatibleSinks, err)
+		}
+	}
+}
+
+func TestReservoirSinkUnmarshalMalformed(t *testing.T) {
+	t.Parallel()
+
+	encode := func(size, length uint64, pairs ...float64) []byte {
+		var buf bytes.Buffer
+		_ = binary.Write(&buf, binary.LittleEndian, reservoirSinkHeader{Size: size, Len: length})
+		_ = binary.Write(&buf, binary.LittleEndian, pairs)
+		return buf.Bytes()
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated header": encode(10, 1, 0.5, 1)[:10],
+		"zero size":        encode(0, 0),
+		"more than size":   encode(1, 2, 0.5, 1, 0.5, 2),
+		"missing values":   encode(10, 2, 0.5, 1),
+		"partial value":    encode(10, 1, 0.5, 1)[:len(encode(10, 1, 0.5, 1))-1],
+		// 1<<60 pairs would take 0 bytes if the length overflowed.
+		"overflowing length": encode(1<<62, 1<<60),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var s ReservoirSink
+			if err := s.UnmarshalBinary(data); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
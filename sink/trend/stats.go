@@ -0,0 +1,84 @@
+package trend
+
+import (
+	"math"
+	"sort"
+)
+
+// weightedValue is a value recorded a number of times (weight), used to approximate
+// the stats that depend on all the values (e.g. the variance) from the Sink implementations
+// that only keep an approximation of their distribution (e.g. the buckets of a histogram,
+// represented by their middle value).
+type weightedValue struct {
+	value  float64
+	weight float64
+}
+
+// varianceOf returns the (population) variance of the given weighted values.
+func varianceOf(values []weightedValue) float64 {
+	var total, sum float64
+	for _, wv := range values {
+		total += wv.weight
+		sum += wv.value * wv.weight
+	}
+	if total == 0 {
+		return 0
+	}
+
+	mean := sum / total
+
+	var squares float64
+	for _, wv := range values {
+		dev := wv.value - mean
+		squares += dev * dev * wv.weight
+	}
+
+	return squares / total
+}
+
+// rankOf returns the fraction of the given weighted values that are lower than
+// or equal to the given one. As the weighted values are an approximation, it is
+// 0 below the given min, and 1 from the given max (of the recorded values) on.
+func rankOf(values []weightedValue, value, min, max float64) float64 {
+	switch {
+	case len(values) == 0 || value < min:
+		return 0
+	case value >= max:
+		return 1
+	}
+
+	var total, under float64
+	for _, wv := range values {
+		total += wv.weight
+		if wv.value <= value {
+			under += wv.weight
+		}
+	}
+
+	return under / total
+}
+
+// madOf returns the median absolute deviation of the given weighted
+// values, around the given median. The given slice is modified.
+func madOf(values []weightedValue, median float64) float64 {
+	var total float64
+	for i, wv := range values {
+		values[i].value = math.Abs(wv.value - median)
+		total += wv.weight
+	}
+	if total == 0 {
+		return 0
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].value < values[j].value })
+
+	var seen float64
+	for _, wv := range values {
+		seen += wv.weight
+		if seen >= total/2 {
+			return wv.value
+		}
+	}
+
+	return values[len(values)-1].value
+}
@@ -0,0 +1,244 @@
+package trend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/caio/go-tdigest"
+
+	"go.k6.io/k6/metrics"
+)
+
+// TDigestSink is a Sink implementation that relies on a t-digest
+// under the hood. So, it is less accurate, but it is bounded in
+// memory, and it is specially accurate for the tails of the
+// distribution (e.g. p(99.9)).
+type TDigestSink struct {
+	digest *tdigest.TDigest
+
+	// The t-digest only keeps the centroids, so the
+	// exact min, max and sum are tracked apart.
+	min, max float64
+	sum      float64
+}
+
+// NewTDigestSink instantiates a new TDigestSink with a compression of 100.
+func NewTDigestSink() *TDigestSink {
+	// The default compression is valid,
+	// so the error can be safely ignored.
+	s, _ := NewTDigestSinkWith(defaultTDigestCompression)
+	return s
+}
+
+// NewTDigestSinkWith instantiates a new TDigestSink with the given compression.
+// The higher it is, the more accurate (but also bigger) the t-digest is.
+// It returns an error if it isn't greater than or equal to 1.
+func NewTDigestSinkWith(compression float64) (*TDigestSink, error) {
+	if compression < 1 || math.IsInf(compression, 0) || math.IsNaN(compression) {
+		return nil, fmt.Errorf("invalid tdigest compression %g, it must be greater than or equal to 1", compression)
+	}
+
+	digest, err := tdigest.New(tdigest.Compression(compression))
+	if err != nil {
+		return nil, fmt.Errorf("invalid tdigest compression %g: %w", compression, err)
+	}
+
+	return &TDigestSink{digest: digest}, nil
+}
+
+// newLike instantiates a new empty TDigestSink with the same compression.
+func (t *TDigestSink) newLike() *TDigestSink {
+	// The compression is the one of an existing
+	// t-digest, so the error can be safely ignored.
+	s, _ := NewTDigestSinkWith(t.digest.Compression())
+	return s
+}
+
+// compatible returns an error if the given TDigestSink has a different compression,
+// as the merged t-digest wouldn't be as accurate as expected by one of them (see Compatible).
+func (t *TDigestSink) compatible(other *TDigestSink) error {
+	if t.digest.Compression() != other.digest.Compression() {
+		return fmt.Errorf("%w: tdigest trend sinks with different compressions (%g and %g)",
+			ErrIncompatibleSinks, t.digest.Compression(), other.digest.Compression())
+	}
+	return nil
+}
+
+// IsEmpty indicates whether the TrendSink is empty.
+func (t *TDigestSink) IsEmpty() bool { return t.digest.Count() == 0 }
+
+// Add implements the Sink interface, recording the value of the given metrics.Sample.
+func (t *TDigestSink) Add(s metrics.Sample) {
+	if err := t.digest.Add(s.Value); err != nil {
+		// It only fails for NaN and infinite values,
+		// which are meaningless for a trend.
+		return
+	}
+
+	if t.digest.Count() == 1 {
+		t.min, t.max = s.Value, s.Value
+	} else {
+		t.min, t.max = math.Min(t.min, s.Value), math.Max(t.max, s.Value)
+	}
+	t.sum += s.Value
+}
+
+// P implements the Sink interface, returning the value at percentile.
+func (t *TDigestSink) P(pct float64) float64 {
+	switch {
+	case t.IsEmpty():
+		return 0
+	case pct <= 0:
+		return t.min
+	case pct >= 1:
+		return t.max
+	}
+
+	// The interpolated value may fall out
+	// of the range of the recorded values.
+	return math.Min(math.Max(t.digest.Quantile(pct), t.min), t.max)
+}
+
+// Min implements the Sink interface, returning the minimum value recorded.
+func (t *TDigestSink) Min() float64 {
+	return t.min
+}
+
+// Max implements the Sink interface, returning the maximum value recorded.
+func (t *TDigestSink) Max() float64 {
+	return t.max
+}
+
+// Count implements the Sink interface, returning the total amount of values recorded.
+func (t *TDigestSink) Count() uint64 {
+	return t.digest.Count()
+}
+
+// Avg implements the Sink interface, returning the average (mean) of values recorded.
+func (t *TDigestSink) Avg() float64 {
+	if t.IsEmpty() {
+		return 0
+	}
+	return t.sum / float64(t.digest.Count())
+}
+
+// Variance implements the Sink interface, returning the variance
+// of values recorded, approximated from the mean of each centroid.
+func (t *TDigestSink) Variance() float64 {
+	return varianceOf(t.centroids())
+}
+
+// MAD implements the Sink interface, returning the median absolute deviation
+// of values recorded, approximated from the mean of each centroid.
+func (t *TDigestSink) MAD() float64 {
+	return madOf(t.centroids(), t.P(0.5))
+}
+
+// Rank implements the Sink interface, returning the fraction of values
+// recorded lower than or equal to the given one, estimated by the t-digest.
+func (t *TDigestSink) Rank(value float64) float64 {
+	switch {
+	case t.IsEmpty() || value < t.min:
+		return 0
+	case value >= t.max:
+		return 1
+	}
+	return t.digest.CDF(value)
+}
+
+// centroids returns the centroids of the t-digest.
+func (t *TDigestSink) centroids() []weightedValue {
+	var centroids []weightedValue
+	t.digest.ForEachCentroid(func(mean float64, count uint64) bool {
+		centroids = append(centroids, weightedValue{value: mean, weight: float64(count)})
+		return true
+	})
+	return centroids
+}
+
+// Format trend and return a map
+func (t *TDigestSink) Format(_ time.Duration) map[string]float64 {
+	return map[string]float64{
+		"min":   t.Min(),
+		"max":   t.Max(),
+		"avg":   t.Avg(),
+		"med":   t.P(0.5),
+		"p(90)": t.P(0.90),
+		"p(95)": t.P(0.95),
+	}
+}
+
+// Merge merges two Sink instances.
+// It returns an error if their compressions don't match.
+func (t *TDigestSink) Merge(s Sink) error {
+	toMerge, ok := s.(*TDigestSink)
+	if !ok {
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, t, s)
+	}
+
+	if err := t.compatible(toMerge); err != nil {
+		return err
+	}
+
+	if toMerge.IsEmpty() {
+		return nil
+	}
+
+	if t.IsEmpty() {
+		t.min, t.max = toMerge.min, toMerge.max
+	} else {
+		t.min, t.max = math.Min(t.min, toMerge.min), math.Max(t.max, toMerge.max)
+	}
+	t.sum += toMerge.sum
+
+	return t.digest.Merge(toMerge.digest)
+}
+
+// We want to make sure that the *TDigestSink
+// implements the Sink interface.
+var _ Sink = &TDigestSink{}
+
+// tdigestSinkHeader is the fixed-size part of the encoded
+// TDigestSink, followed by the encoded t-digest.
+type tdigestSinkHeader struct {
+	Min, Max float64
+	Sum      float64
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface,
+// by using the t-digest's own encoding, preceded by the min, max and sum.
+func (t *TDigestSink) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	header := tdigestSinkHeader{Min: t.min, Max: t.max, Sum: t.sum}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+
+	data, err := t.digest.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf.Bytes(), data...), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (t *TDigestSink) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var header tdigestSinkHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("malformed tdigest trend sink data: %w", err)
+	}
+
+	digest, err := tdigest.FromBytes(r)
+	if err != nil {
+		return fmt.Errorf("malformed tdigest trend sink data: %w", err)
+	}
+
+	t.digest, t.min, t.max, t.sum = digest, header.Min, header.Max, header.Sum
+	return nil
+}
@@ -0,0 +1,54 @@
+package trend
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTDigestSinkAccuracy(t *testing.T) {
+	t.Parallel()
+
+	s := NewTDigestSink()
+	addUniform(s, 100000)
+
+	assertUniformStats(t, s, 100000, 0.001)
+}
+
+func TestTDigestSinkMerge(t *testing.T) {
+	t.Parallel()
+
+	s, other := NewTDigestSink(), NewTDigestSink()
+	addUniform(s, 50000)
+	for i := 50001; i <= 100000; i++ {
+		other.Add(sample(float64(i)))
+	}
+
+	if err := s.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	assertUniformStats(t, s, 100000, 0.001)
+
+	// Merging an empty sink must leave it as is.
+	if err := s.Merge(NewTDigestSink()); err != nil {
+		t.Fatal(err)
+	}
+	assertUniformStats(t, s, 100000, 0.001)
+}
+
+func TestTDigestSinkMergeIncompatible(t *testing.T) {
+	t.Parallel()
+
+	other, err := NewTDigestSinkWith(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, toMerge := range map[string]Sink{
+		"different type":        NewK6Sink(),
+		"different compression": other,
+	} {
+		if err := NewTDigestSink().Merge(toMerge); !errors.Is(err, ErrIncompatibleSinks) {
+			t.Errorf("%s: expected %v, got %v", name, ErrIncompatibleSinks, err)
+		}
+	}
+}
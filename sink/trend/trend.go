@@ -1,7 +1,10 @@
 package trend
 
 import (
-	"os"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
 	"time"
 
 	"go.k6.io/k6/metrics"
@@ -26,44 +29,254 @@ type Sink interface {
 	// Avg returns the average (i.e. mean) value.
 	Avg() float64
 
+	// Variance returns the (population) variance of the values.
+	Variance() float64
+
+	// MAD returns the median absolute deviation of the values,
+	// that is the median of their distances to the median.
+	MAD() float64
+
+	// Rank returns the fraction of values lower than or equal to the
+	// given one, within the [0, 1] range. It is the inverse of P.
+	Rank(value float64) float64
+
 	// Add a single sample into the trend
 	Add(s metrics.Sample)
 
 	// Merge merges two Sink instances.
-	Merge(s Sink)
+	// It returns an error if the implementations don't match.
+	Merge(s Sink) error
 
 	// Format returns data for thresholds.
 	Format(t time.Duration) map[string]float64
 
 	// IsEmpty check if the Sink is empty.
 	IsEmpty() bool
+
+	// MarshalBinary encodes the Sink. Note that it doesn't include
+	// the implementation type, so it must be decoded by the same one.
+	// Use Marshal and Unmarshal to encode and decode any Sink.
+	MarshalBinary() ([]byte, error)
 }
 
-// NewSink instantiates a new Sink.
+// ErrIncompatibleSinks is returned when trying to merge
+// two different implementations of Sink.
+var ErrIncompatibleSinks = errors.New("trying to merge incompatible trend sinks")
+
+// NewSink instantiates a new Sink of the default implementation, the *K6Sink.
 //
-// By default, it initializes a *K6Sink.
-// This can be changed by using the XK6_CUSTOSUMMARY_TRENDSINK_TYPE environment variable.
-// Possible values are:
-//   - "k6" (default) => *K6Sink
-//   - "hdr"		  => HdrHistogramSink
-//   - "dds" 		  => DDSketchHistogramSink
+// Use SinkTypes to select a different type for each metric, or for all of them,
+// as set with the XK6_CUSTOSUMMARY_TRENDSINK_TYPE environment variable (see SinkTypesFromEnv).
 func NewSink() Sink {
-	sinkType, ok := os.LookupEnv(sinkTypeEnvVar)
-	if !ok || len(sinkType) == 0 {
-		return NewK6Sink() // Default
-	}
+	return NewSinkFor(metrics.Default)
+}
 
-	switch sinkType {
-	case "hdr":
-		return NewHdrHistogramSink()
-	case "dds":
-		return NewDDSketchHistogramSink()
-	case "k6":
+// NewSinkFor is like NewSink, but for a metric that contains values of the given
+// type, which some implementations use to adjust their precision (e.g. HdrHistogramSink).
+func NewSinkFor(contains metrics.ValueType) Sink {
+	return DefaultSinkConfig(sinkTypeK6).NewSink(contains)
+}
+
+// NewSinkLike instantiates a new empty Sink of the same
+// implementation, and with the same parameters, as the given one.
+func NewSinkLike(s Sink) Sink {
+	switch typed := s.(type) {
+	case HdrHistogramSink:
+		return typed.newLike()
+	case DDSketchHistogramSink:
+		return typed.newLike()
+	case *TDigestSink:
+		return typed.newLike()
+	case *ReservoirSink:
+		return typed.newLike()
+	case *CircllhistSink:
+		return NewCircllhistSink()
+	case *AdaptiveSink:
+		return typed.newLike()
+	case *CheckedSink:
+		return typed.newLike()
+	default:
 		return NewK6Sink()
+	}
+}
+
+// Compatible returns an error if the given sinks cannot be merged (see Sink.Merge),
+// because they are different implementations, or the same one with different parameters.
+// Unlike merging them, it neither modifies nor allocates any sink, so it is cheap to check
+// many of them.
+func Compatible(a, b Sink) error {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return fmt.Errorf("%w: %T and %T", ErrIncompatibleSinks, a, b)
+	}
+
+	switch typed := a.(type) {
+	case HdrHistogramSink:
+		return typed.compatible(b.(HdrHistogramSink))
+	case DDSketchHistogramSink:
+		return typed.compatible(b.(DDSketchHistogramSink))
+	case *TDigestSink:
+		return typed.compatible(b.(*TDigestSink))
+	case *ReservoirSink:
+		return typed.compatible(b.(*ReservoirSink))
+	case *AdaptiveSink:
+		return typed.compatible(b.(*AdaptiveSink))
+	case *CheckedSink:
+		return typed.compatible(b.(*CheckedSink))
 	default:
-		panic("unknown trend sink type: " + sinkType)
+		return nil
+	}
+}
+
+// IsExact returns whether the stats of the given Sink are exact, or approximated.
+func IsExact(s Sink) bool {
+	switch typed := s.(type) {
+	case *K6Sink:
+		return true
+	case *AdaptiveSink:
+		return typed.IsExact()
+	case *CheckedSink:
+		return IsExact(typed.approx)
+	default:
+		return false
+	}
+}
+
+// MergeAll merges all the given sinks into a new one, of the same implementation.
+// It is equivalent to merging them one by one into an empty sink (see NewSinkLike),
+// but some implementations (e.g. *K6Sink) can merge them all at once more efficiently,
+// even without copying their values. So, the given sinks are not modified, but they must
+// not be while the merged one is in use. It returns an error if the implementations don't
+// match, and nil if there are no sinks.
+func MergeAll(sinks ...Sink) (Sink, error) {
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	if k6Sinks, ok := allK6Sinks(sinks); ok {
+		return mergeK6Sinks(k6Sinks), nil
+	}
+
+	merged := NewSinkLike(sinks[0])
+	for _, s := range sinks {
+		if err := merged.Merge(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
+
+func allK6Sinks(sinks []Sink) ([]*K6Sink, bool) {
+	k6Sinks := make([]*K6Sink, 0, len(sinks))
+	for _, s := range sinks {
+		typed, ok := s.(*K6Sink)
+		if !ok {
+			return nil, false
+		}
+		k6Sinks = append(k6Sinks, typed)
 	}
+	return k6Sinks, true
 }
 
-// Possible values are: "k6" (default), "hdr", and "dds".
+// Possible values are: "k6" (default), "hdr", "dds", "tdigest", "reservoir", "circllhist", and "adaptive".
 const sinkTypeEnvVar = "XK6_CUSTOSUMMARY_TRENDSINK_TYPE"
+
+// Possible values are: "false" (default) and "true" (see CheckedSink).
+const sinkCheckEnvVar = "XK6_CUSTOSUMMARY_TRENDSINK_CHECK"
+
+// Sink types, as used in the XK6_CUSTOSUMMARY_TRENDSINK_TYPE
+// environment variable and to identify them once encoded.
+const (
+	sinkTypeK6         = "k6"
+	sinkTypeHdr        = "hdr"
+	sinkTypeDDS        = "dds"
+	sinkTypeTDigest    = "tdigest"
+	sinkTypeReservoir  = "reservoir"
+	sinkTypeCircllhist = "circllhist"
+	sinkTypeAdaptive   = "adaptive"
+
+	// sinkTypeChecked is only used to identify the encoded *CheckedSink,
+	// as it isn't a type that can be selected (see SinkTypes.SetCheck).
+	sinkTypeChecked = "checked"
+)
+
+// Marshal encodes the given Sink, prefixed by its type,
+// so it can be decoded with Unmarshal.
+func Marshal(s Sink) ([]byte, error) {
+	var sinkType string
+	switch s.(type) {
+	case *K6Sink:
+		sinkType = sinkTypeK6
+	case HdrHistogramSink:
+		sinkType = sinkTypeHdr
+	case DDSketchHistogramSink:
+		sinkType = sinkTypeDDS
+	case *TDigestSink:
+		sinkType = sinkTypeTDigest
+	case *ReservoirSink:
+		sinkType = sinkTypeReservoir
+	case *CircllhistSink:
+		sinkType = sinkTypeCircllhist
+	case *AdaptiveSink:
+		sinkType = sinkTypeAdaptive
+	case *CheckedSink:
+		sinkType = sinkTypeChecked
+	default:
+		return nil, fmt.Errorf("unsupported trend sink type: %T", s)
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte{byte(len(sinkType))}, sinkType...), data...), nil
+}
+
+// Unmarshal decodes a Sink previously encoded with Marshal.
+func Unmarshal(data []byte) (Sink, error) {
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return nil, fmt.Errorf("malformed trend sink data")
+	}
+	sinkType, data := string(data[1:1+int(data[0])]), data[1+int(data[0]):]
+
+	var s interface {
+		Sink
+		encoding.BinaryUnmarshaler
+	}
+
+	switch sinkType {
+	case sinkTypeK6:
+		s = &K6Sink{}
+	case sinkTypeHdr:
+		s = &HdrHistogramSink{}
+	case sinkTypeDDS:
+		s = &DDSketchHistogramSink{}
+	case sinkTypeTDigest:
+		s = &TDigestSink{}
+	case sinkTypeReservoir:
+		s = &ReservoirSink{}
+	case sinkTypeCircllhist:
+		s = &CircllhistSink{}
+	case sinkTypeAdaptive:
+		s = &AdaptiveSink{}
+	case sinkTypeChecked:
+		s = &CheckedSink{}
+	default:
+		return nil, fmt.Errorf("unknown trend sink type: %s", sinkType)
+	}
+
+	if err := s.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	// HdrHistogramSink and DDSketchHistogramSink are used by value.
+	switch typed := s.(type) {
+	case *HdrHistogramSink:
+		return *typed, nil
+	case *DDSketchHistogramSink:
+		return *typed, nil
+	default:
+		return s, nil
+	}
+}
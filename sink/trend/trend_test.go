@@ -0,0 +1,109 @@
+package trend
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+
+	"go.k6.io/k6/metrics"
+)
+
+func TestCompatible(t *testing.T) {
+	t.Parallel()
+
+	mustHdr := func(lowest, highest int64, digits int, scale float64) Sink {
+		s, err := NewHdrHistogramSinkWith(lowest, highest, digits, scale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	mustTDigest := func(compression float64) Sink {
+		s, err := NewTDigestSinkWith(compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	mustReservoir := func(size int) Sink {
+		s, err := NewReservoirSinkWith(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	mustDDS := func(accuracy float64) Sink {
+		s, err := NewDDSketchHistogramSinkWith(accuracy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	for _, tc := range []struct {
+		name       string
+		a, b       Sink
+		compatible bool
+	}{
+		{name: "k6", a: NewK6Sink(), b: NewK6Sink(), compatible: true},
+		{name: "hdr", a: NewHdrHistogramSink(), b: mustHdr(defaultHdrLowest, defaultHdrHighest, defaultHdrDigits, 1), compatible: true},
+		{name: "dds", a: NewDDSketchHistogramSink(), b: mustDDS(defaultDDSAccuracy), compatible: true},
+		{name: "tdigest", a: NewTDigestSink(), b: mustTDigest(defaultTDigestCompression), compatible: true},
+		{name: "reservoir", a: NewReservoirSink(), b: mustReservoir(defaultReservoirSize), compatible: true},
+		{name: "circllhist", a: NewCircllhistSink(), b: NewCircllhistSink(), compatible: true},
+		{name: "different types", a: NewK6Sink(), b: NewDDSketchHistogramSink()},
+		{name: "hdr with different ranges", a: NewHdrHistogramSink(), b: mustHdr(1, 1000, defaultHdrDigits, 1)},
+		{name: "hdr with different digits", a: NewHdrHistogramSink(), b: mustHdr(defaultHdrLowest, defaultHdrHighest, 3, 1)},
+		{name: "hdr with different scales", a: NewHdrHistogramSink(), b: mustHdr(defaultHdrLowest, defaultHdrHighest, defaultHdrDigits, 1000)},
+		{name: "dds with different accuracies", a: NewDDSketchHistogramSink(), b: mustDDS(0.05)},
+		{name: "tdigest with different compressions", a: NewTDigestSink(), b: mustTDigest(200)},
+		{name: "reservoir with different sizes", a: NewReservoirSink(), b: mustReservoir(100)},
+	} {
+		err := Compatible(tc.a, tc.b)
+		switch {
+		case tc.compatible && err != nil:
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		case !tc.compatible && !errors.Is(err, ErrIncompatibleSinks):
+			t.Errorf("%s: expected %v, got %v", tc.name, ErrIncompatibleSinks, err)
+		}
+	}
+}
+
+// addUniform adds the integers from 1 to n to the given sink, in a (deterministic) random order,
+// so the value at any percentile is known: p(x) is around x*n.
+func addUniform(s Sink, n int) {
+	r := rand.New(rand.NewSource(int64(n)))
+	for _, i := range r.Perm(n) {
+		s.Add(sample(float64(i + 1)))
+	}
+}
+
+// assertUniformStats checks the stats of a sink with the values added by addUniform,
+// where the percentiles must be accurate up to the given rank error (e.g. with 0.01,
+// the p(90) must be between the actual p(89) and p(91)).
+func assertUniformStats(t *testing.T, s Sink, n int, rankError float64) {
+	t.Helper()
+
+	if got := s.Count(); got != uint64(n) {
+		t.Errorf("count: expected %d, got %d", n, got)
+	}
+	if got := s.Min(); got != 1 {
+		t.Errorf("min: expected 1, got %v", got)
+	}
+	if got := s.Max(); got != float64(n) {
+		t.Errorf("max: expected %d, got %v", n, got)
+	}
+	if want, got := float64(n+1)/2, s.Avg(); math.Abs(want-got) > 1e-9*want {
+		t.Errorf("avg: expected %v, got %v", want, got)
+	}
+	for _, pct := range []float64{0.01, 0.25, 0.5, 0.9, 0.95, 0.99, 0.999} {
+		if want, got := pct*float64(n), s.P(pct); math.Abs(want-got) > rankError*float64(n) {
+			t.Errorf("p(%g): expected %v (±%v), got %v", pct*100, want, rankError*float64(n), got)
+		}
+	}
+}
+
+func sample(value float64) metrics.Sample {
+	return metrics.Sample{Value: value}
+}
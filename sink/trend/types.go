@@ -0,0 +1,266 @@
+package trend
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.k6.io/k6/metrics"
+)
+
+// DefaultSinkType returns the sink type set with the XK6_CUSTOSUMMARY_TRENDSINK_TYPE
+// environment variable, or "k6" if it isn't set. It may include the type parameters.
+func DefaultSinkType() string {
+	sinkType, ok := os.LookupEnv(sinkTypeEnvVar)
+	if !ok || len(sinkType) == 0 {
+		return sinkTypeK6
+	}
+	return sinkType
+}
+
+// SinkTypesFromEnv returns a new SinkTypes that falls back to the sink type set with the
+// XK6_CUSTOSUMMARY_TRENDSINK_TYPE environment variable, if any (see DefaultSinkType).
+// Possible values are:
+//   - "k6" (default) => *K6Sink
+//   - "hdr"		  => HdrHistogramSink
+//   - "dds" 		  => DDSketchHistogramSink
+//   - "tdigest"	  => *TDigestSink
+//   - "reservoir"	  => *ReservoirSink
+//   - "circllhist"	  => *CircllhistSink
+//   - "adaptive"	  => *AdaptiveSink
+//
+// The parameters of the type can also be given (see ParseSinkConfig). If the
+// XK6_CUSTOSUMMARY_TRENDSINK_CHECK environment variable is set to true, the
+// approximate implementations are checked against an exact one (see SetCheck).
+//
+// The environment variables are only read once, here, so it returns an error
+// if they hold an invalid value, instead of failing on every new Sink.
+func SinkTypesFromEnv() (*SinkTypes, error) {
+	cfg, err := ParseSinkConfig(DefaultSinkType())
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", sinkTypeEnvVar, err)
+	}
+
+	st := NewSinkTypes()
+	if err := st.Configure(cfg, nil); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", sinkTypeEnvVar, err)
+	}
+
+	if check, ok := os.LookupEnv(sinkCheckEnvVar); ok && len(check) > 0 {
+		enabled, err := strconv.ParseBool(check)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s', possible values are: true, false", sinkCheckEnvVar, check)
+		}
+		st.SetCheck(enabled)
+	}
+
+	return st, nil
+}
+
+// SinkTypeRule selects the Sink type (and its parameters) of the metrics with
+// the given name or, if Regexp is set, of the metrics whose name matches it.
+type SinkTypeRule struct {
+	Name   string
+	Regexp *regexp.Regexp
+	Sink   SinkConfig
+}
+
+// NewSinkTypeRule returns a new SinkTypeRule for the metric with the given name.
+// The sink type is parsed with ParseSinkConfig.
+func NewSinkTypeRule(metric, sinkType string) (SinkTypeRule, error) {
+	cfg, err := ParseSinkConfig(sinkType)
+	if err != nil {
+		return SinkTypeRule{}, err
+	}
+	return SinkTypeRule{Name: metric, Sink: cfg}, nil
+}
+
+// NewSinkTypeRuleByRegexp returns a new SinkTypeRule for the metrics whose name matches
+// the given regexp. The sink type is parsed with ParseSinkConfig.
+func NewSinkTypeRuleByRegexp(re, sinkType string) (SinkTypeRule, error) {
+	compiled, err := regexp.Compile(re)
+	if err != nil {
+		return SinkTypeRule{}, fmt.Errorf("invalid metrics regexp '%s': %w", re, err)
+	}
+	cfg, err := ParseSinkConfig(sinkType)
+	if err != nil {
+		return SinkTypeRule{}, err
+	}
+	return SinkTypeRule{Regexp: compiled, Sink: cfg}, nil
+}
+
+// Matches returns whether the rule applies to the metric with the given name.
+// The rules also apply to the sub-metrics (e.g. `http_req_duration{expected_response:true}`)
+// of the metrics they select, so they're matched against their base name too.
+func (r SinkTypeRule) Matches(metric string) bool {
+	base, _, isSubmetric := strings.Cut(metric, "{")
+	if r.Regexp != nil {
+		return r.Regexp.MatchString(metric) || (isSubmetric && r.Regexp.MatchString(base))
+	}
+	return r.Name == metric || (isSubmetric && r.Name == base)
+}
+
+func (r SinkTypeRule) equal(other SinkTypeRule) bool {
+	if (r.Regexp == nil) != (other.Regexp == nil) {
+		return false
+	}
+	if r.Regexp != nil && r.Regexp.String() != other.Regexp.String() {
+		return false
+	}
+	return r.Name == other.Name && r.Sink == other.Sink
+}
+
+// ParseSinkTypeRules parses a list of SinkTypeRule, separated by semicolons.
+//
+// Each rule has the format "metric=type", or "/regexp/=type" to select metrics
+// by regexp, where the type may include its parameters (see ParseSinkConfig).
+// For instance: "http_req_duration=dds(accuracy=0.001);/^custom_/=dds(accuracy=0.05)".
+func ParseSinkTypeRules(s string) ([]SinkTypeRule, error) {
+	var rules []SinkTypeRule
+	for _, raw := range strings.Split(s, ";") {
+		raw = strings.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+
+		// The type parameters also contain '=', so the separator is the first one
+		// after the metric name or, in case of a regexp, after its closing slash.
+		idx := strings.Index(raw, "=")
+		if strings.HasPrefix(raw, "/") {
+			if end := strings.LastIndex(raw, "/="); end > 0 {
+				idx = end + 1
+			}
+		}
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid trend sink type rule '%s', expected 'metric=type' or '/regexp/=type'", raw)
+		}
+		metric, sinkType := strings.TrimSpace(raw[:idx]), strings.TrimSpace(raw[idx+1:])
+
+		var (
+			rule SinkTypeRule
+			err  error
+		)
+		if len(metric) > 1 && strings.HasPrefix(metric, "/") && strings.HasSuffix(metric, "/") {
+			rule, err = NewSinkTypeRuleByRegexp(metric[1:len(metric)-1], sinkType)
+		} else {
+			rule, err = NewSinkTypeRule(metric, sinkType)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// SinkTypes selects the Sink type of each trend metric, by name or by regexp,
+// falling back to a default one for the metrics that don't match any rule.
+//
+// Rules are evaluated in the order they were added, and the first one that matches
+// is used, except for the ones given with Configure, that are always evaluated first.
+// Once a metric got its Sink type, it is kept for the rest of the test run, even if
+// new rules are added later, so all the time series of the same metric can always
+// be merged.
+//
+// It is safe for concurrent use.
+type SinkTypes struct {
+	mu          sync.Mutex
+	defaultType SinkConfig
+	configured  []SinkTypeRule
+	rules       []SinkTypeRule
+	resolved    map[string]SinkConfig
+	check       bool
+}
+
+// NewSinkTypes returns a new SinkTypes that falls back to "k6".
+func NewSinkTypes() *SinkTypes {
+	return &SinkTypes{
+		defaultType: DefaultSinkConfig(sinkTypeK6),
+		resolved:    make(map[string]SinkConfig),
+	}
+}
+
+// Configure sets the default Sink type, and the rules that take
+// precedence over the ones added with Add (e.g. from the environment).
+func (st *SinkTypes) Configure(defaultType SinkConfig, rules []SinkTypeRule) error {
+	if err := defaultType.Validate(); err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.defaultType = defaultType
+	st.configured = rules
+	return nil
+}
+
+// SetCheck enables (or disables) the accuracy self-check mode, where
+// the approximate sinks are checked against an exact one (see CheckedSink).
+func (st *SinkTypes) SetCheck(check bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.check = check
+}
+
+// Add adds the given rule, evaluated after the ones already added.
+// Rules equal to an already added one are ignored, because the init
+// context, where they are usually added from, runs once per VU.
+func (st *SinkTypes) Add(rule SinkTypeRule) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, r := range st.rules {
+		if r.equal(rule) {
+			return
+		}
+	}
+
+	st.rules = append(st.rules, rule)
+}
+
+// Of returns the Sink type (and its parameters) of the metric with the given name.
+func (st *SinkTypes) Of(metric string) SinkConfig {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if sinkType, ok := st.resolved[metric]; ok {
+		return sinkType
+	}
+
+	sinkType := st.match(metric)
+	st.resolved[metric] = sinkType
+	return sinkType
+}
+
+func (st *SinkTypes) match(metric string) SinkConfig {
+	for _, rules := range [][]SinkTypeRule{st.configured, st.rules} {
+		for _, rule := range rules {
+			if rule.Matches(metric) {
+				return rule.Sink
+			}
+		}
+	}
+	return st.defaultType
+}
+
+// NewSink instantiates a new Sink for the given metric.
+func (st *SinkTypes) NewSink(m *metrics.Metric) Sink {
+	// All the types are validated when the rules are created,
+	// so it is safe to instantiate the Sink.
+	s := st.Of(m.Name).NewSink(m.Contains)
+
+	st.mu.Lock()
+	check := st.check
+	st.mu.Unlock()
+
+	if check {
+		return NewCheckedSink(s)
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package trend
+
+import (
+	"testing"
+
+	"go.k6.io/k6/metrics"
+)
+
+func TestSinkTypeRuleMatchesSubmetrics(t *testing.T) {
+	t.Parallel()
+
+	byName, err := NewSinkTypeRule("http_req_duration", "dds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byRegexp, err := NewSinkTypeRuleByRegexp("^http_req_duration$", "dds")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		metric string
+		want   bool
+	}{
+		{metric: "http_req_duration", want: true},
+		{metric: "http_req_duration{expected_response:true}", want: true},
+		{metric: "http_req_duration_total", want: false},
+		{metric: "http_reqs{http_req_duration:x}", want: false},
+	} {
+		for _, rule := range []SinkTypeRule{byName, byRegexp} {
+			if got := rule.Matches(tc.metric); got != tc.want {
+				t.Errorf("%s (name=%q, regexp=%v): expected %v, got %v", tc.metric, rule.Name, rule.Regexp, tc.want, got)
+			}
+		}
+	}
+
+	st := NewSinkTypes()
+	st.Add(byName)
+	if got := st.Of("http_req_duration{expected_response:true}"); got.Type != sinkTypeDDS {
+		t.Errorf("expected the sub-metric to get the %q sink type, got %q", sinkTypeDDS, got.Type)
+	}
+}
+
+func TestSinkTypesFromEnv(t *testing.T) {
+	t.Setenv(sinkTypeEnvVar, "dds")
+
+	st, err := SinkTypesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := st.Of("http_req_duration"); got.Type != sinkTypeDDS {
+		t.Errorf("expected the %q sink type, got %q", sinkTypeDDS, got.Type)
+	}
+
+	// An unknown value is reported once, and the default sink is still usable.
+	t.Setenv(sinkTypeEnvVar, "unknown")
+	if _, err := SinkTypesFromEnv(); err == nil {
+		t.Error("expected an error for an unknown sink type")
+	}
+	if _, isK6 := NewSink().(*K6Sink); !isK6 {
+		t.Errorf("expected a *K6Sink by default, got %T", NewSink())
+	}
+
+	// The accuracy self-check mode is read along with it.
+	t.Setenv(sinkTypeEnvVar, "dds")
+	t.Setenv(sinkCheckEnvVar, "true")
+	st, err = SinkTypesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &metrics.Metric{Name: "http_req_duration", Type: metrics.Trend, Contains: metrics.Time}
+	if got := st.NewSink(m); !isCheckedSink(got) {
+		t.Errorf("expected a *CheckedSink, got %T", got)
+	}
+
+	t.Setenv(sinkCheckEnvVar, "maybe")
+	if _, err := SinkTypesFromEnv(); err == nil {
+		t.Error("expected an error for an invalid check value")
+	}
+}
+
+func isCheckedSink(s Sink) bool {
+	_, ok := s.(*CheckedSink)
+	return ok
+}
@@ -0,0 +1,54 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// Merge merges the given snapshots (e.g. from the same test, run on several load
+// generators) into a new one, by merging the sinks of the time series with the same
+// key (see sink.Sink.Merge). So, percentiles are exact when the trend sinks are
+// *trend.K6Sink, and as accurate as each implementation permits otherwise.
+//
+// The duration of the resulting snapshot is the longest one, as the
+// load generators are expected to run (mostly) in parallel.
+//
+// The given snapshots aren't modified, and it returns an error if the time series
+// with the same key, or of the same metric, have different shapes or sink types
+// (see timeseries.Collection.Validate), as they couldn't be merged to build the report.
+func Merge(snapshots ...Snapshot) (Snapshot, error) {
+	if len(snapshots) == 0 {
+		return Snapshot{}, errors.New("no snapshots to merge")
+	}
+
+	result := Snapshot{Collection: timeseries.NewCollection()}
+	for i, s := range snapshots {
+		if s.Duration > result.Duration {
+			result.Duration = s.Duration
+		}
+
+		for key, ts := range s.Collection {
+			merged, exists := result.Collection[key]
+			if !exists {
+				merged = timeseries.TimeSeries{Key: key, Meta: ts.Meta, Sink: sink.NewLike(ts.Sink)}
+				result.Collection[key] = merged
+			}
+
+			if merged.Meta != ts.Meta {
+				return Snapshot{}, fmt.Errorf("snapshot #%d: time series %s has an inconsistent shape", i+1, key)
+			}
+			if err := merged.Sink.Merge(ts.Sink); err != nil {
+				return Snapshot{}, fmt.Errorf("snapshot #%d: time series %s: %w", i+1, key, err)
+			}
+		}
+	}
+
+	if err := result.Collection.Validate(); err != nil {
+		return Snapshot{}, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+
+	"go.k6.io/k6/lib"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+)
+
+// ReadReportFile reads a report.Report from the named file, which can be either
+// a snapshot (see Snapshot.WriteFile) or a JSON-encoded report (see report.ReadJSON).
+// In the former case, the report is built with the given lib.Options, and with the
+// Apdex of the metrics with a target in the given report.ApdexTargets, if any, so
+// they can be compared against the ones of another report (see report.Report.AddApdex).
+func ReadReportFile(name string, opts lib.Options, apdex report.ApdexTargets) (report.Report, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return report.Report{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	br := bufio.NewReader(f)
+	if prefix, _ := br.Peek(len(magic)); !bytes.Equal(prefix, []byte(magic)) {
+		return report.ReadJSON(br)
+	}
+
+	s, err := Read(br)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	r, err := report.From(s.Collection, s.Duration, opts)
+	if err != nil {
+		return report.Report{}, err
+	}
+	if err := r.AddApdex(s.Collection, apdex); err != nil {
+		return report.Report{}, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,70 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func TestReadReportFileApdex(t *testing.T) {
+	t.Parallel()
+
+	c := timeseries.NewCollection()
+	for name, meta := range map[string]timeseries.Meta{
+		"http_req_duration": {Type: metrics.Trend, Contains: metrics.Time},
+		"data_trend":        {Type: metrics.Trend, Contains: metrics.Data},
+	} {
+		key := timeseries.NewKeyFromTags(name, nil)
+		ts := timeseries.TimeSeries{Key: key, Meta: meta, Sink: sink.New(metrics.Trend)}
+		for _, v := range []float64{50, 100, 150, 400, 401, 1000} {
+			ts.Sink.Add(metrics.Sample{Value: v})
+		}
+		c[key] = ts
+	}
+
+	name := filepath.Join(t.TempDir(), "baseline.snapshot")
+	if err := (Snapshot{Duration: time.Minute, Collection: c}).WriteFile(name); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := lib.Options{SummaryTrendStats: []string{"avg"}}
+
+	// The Apdex of the snapshot baselines is calculated with the given targets,
+	// so it can be compared against the one of the test (see report.Report.AddApdex).
+	r, err := ReadReportFile(name, opts, report.ApdexTargets{"http_req_duration": {T: 100, IsDuration: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := report.Apdex{T: 100, Score: 0.5, Satisfied: 2, Tolerating: 2, Frustrated: 2}
+	if got := r.Metrics["http_req_duration"].Apdex; got == nil || *got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if got := r.Metrics["http_req_duration"].Values["apdex"]; got != want.Score {
+		t.Errorf("expected the apdex value to be %v, got %v", want.Score, got)
+	}
+	if got := r.Metrics["data_trend"].Apdex; got != nil {
+		t.Errorf("expected no Apdex for the metric without target, got %+v", got)
+	}
+
+	// Without targets, there's no Apdex.
+	r, err = ReadReportFile(name, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Metrics["http_req_duration"].Apdex; got != nil {
+		t.Errorf("expected no Apdex without targets, got %+v", got)
+	}
+
+	// Targets given as a duration don't apply to metrics whose values aren't durations.
+	if _, err := ReadReportFile(name, opts, report.ApdexTargets{"data_trend": {T: 100, IsDuration: true}}); err == nil {
+		t.Fatal("expected an error for a duration target on a data trend")
+	}
+}
@@ -0,0 +1,211 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+// Snapshot is a point-in-time copy of a timeseries.Collection, along with the
+// test duration, so it can be persisted to disk and used to build the report
+// (and the summary) offline, without having to re-run the test.
+type Snapshot struct {
+	Duration   time.Duration
+	Collection timeseries.Collection
+}
+
+// The encoded snapshot starts with the magic bytes, followed by the format version.
+const (
+	magic   = "XK6CS"
+	version = 2
+)
+
+// WriteTo encodes the snapshot in a compact binary format, and writes it to the given io.Writer.
+//
+// The format is (all numbers little-endian):
+//   - The magic bytes ("XK6CS") and the format version (1 byte).
+//   - The test duration, in nanoseconds (8 bytes), and the amount of time series (uvarint).
+//   - For each time series: the key (uvarint length + bytes), the metric type and
+//     value type (1 byte each), and the encoded sink (uvarint length + bytes).
+func (s Snapshot) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	buf := append([]byte(magic), version)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(s.Duration))
+	buf = binary.AppendUvarint(buf, uint64(len(s.Collection)))
+	if _, err := bw.Write(buf); err != nil {
+		return cw.n, err
+	}
+
+	for key, ts := range s.Collection {
+		data, err := ts.Sink.MarshalBinary()
+		if err != nil {
+			return cw.n, fmt.Errorf("failed to encode time series %s: %w", key, err)
+		}
+
+		buf = binary.AppendUvarint(buf[:0], uint64(len(key)))
+		buf = append(buf, key...)
+		buf = append(buf, byte(ts.Meta.Type), byte(ts.Meta.Contains))
+		buf = binary.AppendUvarint(buf, uint64(len(data)))
+		if _, err := bw.Write(buf); err != nil {
+			return cw.n, err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return cw.n, err
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Read decodes a snapshot previously encoded with Snapshot.WriteTo from the given io.Reader.
+func Read(r io.Reader) (Snapshot, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic)+1+8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return Snapshot{}, fmt.Errorf("malformed snapshot: %w", err)
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return Snapshot{}, errors.New("malformed snapshot: not a snapshot file")
+	}
+	if v := header[len(magic)]; v != version {
+		return Snapshot{}, fmt.Errorf("unsupported snapshot version: %d", v)
+	}
+
+	s := Snapshot{
+		Duration:   time.Duration(binary.LittleEndian.Uint64(header[len(magic)+1:])),
+		Collection: timeseries.NewCollection(),
+	}
+
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("malformed snapshot: %w", err)
+	}
+
+	for i := uint64(0); i < n; i++ {
+		ts, err := readTimeSeries(br)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("malformed snapshot: %w", err)
+		}
+		s.Collection[ts.Key] = ts
+	}
+
+	return s, nil
+}
+
+// WriteFile encodes the snapshot (see Snapshot.WriteTo) into the named file.
+func (s Snapshot) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.WriteTo(f)
+	return errors.Join(err, f.Close())
+}
+
+// ReadFile decodes a snapshot (see Read) from the named file.
+func ReadFile(name string) (Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return Read(f)
+}
+
+func readTimeSeries(br *bufio.Reader) (timeseries.TimeSeries, error) {
+	key, err := readBytes(br)
+	if err != nil {
+		return timeseries.TimeSeries{}, err
+	}
+
+	var meta [2]byte
+	if _, err := io.ReadFull(br, meta[:]); err != nil {
+		return timeseries.TimeSeries{}, err
+	}
+	mt, vt := metrics.MetricType(meta[0]), metrics.ValueType(meta[1])
+
+	data, err := readBytes(br)
+	if err != nil {
+		return timeseries.TimeSeries{}, err
+	}
+
+	s, err := newSinkFor(mt)
+	if err != nil {
+		return timeseries.TimeSeries{}, err
+	}
+	if err := s.UnmarshalBinary(data); err != nil {
+		return timeseries.TimeSeries{}, fmt.Errorf("time series %s: %w", key, err)
+	}
+
+	return timeseries.TimeSeries{
+		Key:  timeseries.Key(key),
+		Meta: timeseries.Meta{Type: mt, Contains: vt},
+		Sink: s,
+	}, nil
+}
+
+// newSinkFor is like sink.New, but it returns an error instead
+// of panicking when the metric type is unknown.
+func newSinkFor(mt metrics.MetricType) (sink.Sink, error) {
+	switch mt {
+	case metrics.Counter, metrics.Gauge, metrics.Rate, metrics.Trend:
+		return sink.New(mt), nil
+	default:
+		return nil, fmt.Errorf("unknown metric type: %d", mt)
+	}
+}
+
+// maxFieldSize is the maximum size of each variable-length field (i.e. the keys
+// and the encoded sinks), far above the size of any real one, to detect corrupt
+// lengths before reading them.
+const maxFieldSize = 1 << 30
+
+// readBytes reads a variable-length field (uvarint length + bytes). Its buffer
+// grows as the bytes are read, instead of being allocated from the length
+// upfront, so a corrupt (or truncated) snapshot fails without exhausting memory.
+func readBytes(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxFieldSize {
+		return nil, fmt.Errorf("field of %d bytes exceeds the maximum of %d", n, maxFieldSize)
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, br, int64(n)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// countingWriter is an io.Writer that counts the bytes written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
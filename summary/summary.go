@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"os"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"unicode/utf8"
 
+	"golang.org/x/term"
 	"golang.org/x/text/unicode/norm"
 
 	"go.k6.io/k6/lib"
@@ -45,9 +47,56 @@ func (ss Summary) WriteTo(w io.Writer) (n int64, err error) {
 	return
 }
 
-// From creates a Summary from a report.Report.
+// WithoutColors returns a copy of the summary without the
+// ANSI escape sequences used to decorate (colorize) it.
+func (ss Summary) WithoutColors() Summary {
+	plain := make(Summary, len(ss))
+	for i, s := range ss {
+		plain[i] = ansiEscapeSeq.ReplaceAllString(s, "")
+	}
+	return plain
+}
+
+var ansiEscapeSeq = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Layout defines the characteristics of the output the Summary is written to,
+// for the parts that adapt to it (e.g. the distributions, see report.Metric).
+type Layout struct {
+	// Width is the number of columns available (e.g. the terminal width).
+	// If zero, defaultWidth is assumed.
+	Width int
+
+	// Plain is set when the output doesn't support colors, so only
+	// plain ASCII characters are used (e.g. for the distribution bars).
+	Plain bool
+}
+
+// defaultWidth is the number of columns assumed when the Layout doesn't set it.
+const defaultWidth = 80
+
+// LayoutFor returns the Layout for writing the summary into the given file:
+// its width, if it's a terminal, and plain if colors are disabled (noColor).
+func LayoutFor(f *os.File, noColor bool) Layout {
+	layout := Layout{Plain: noColor}
+
+	fd := int(f.Fd())
+	if term.IsTerminal(fd) {
+		if width, _, err := term.GetSize(fd); err == nil {
+			layout.Width = width
+		}
+	}
+
+	return layout
+}
+
+// From creates a Summary from a report.Report, for the default Layout.
 // It is heavily inspired by the JavaScript implementation in k6.
 func From(r report.Report, opts lib.Options) Summary {
+	return FromWith(r, opts, Layout{})
+}
+
+// FromWith creates a Summary from a report.Report, for the given Layout.
+func FromWith(r report.Report, opts lib.Options, layout Layout) Summary {
 	var s Summary
 
 	const indent = "   "
@@ -56,6 +105,7 @@ func From(r report.Report, opts lib.Options) Summary {
 	nameLenMax := 0
 
 	nonTrendValues := map[string]string{}
+	nonTrendDeltas := map[string]string{}
 	nonTrendValueMaxLen := 0
 	nonTrendExtras := map[string][]string{}
 	nonTrendExtraMaxLens := []int{0, 0}
@@ -67,6 +117,9 @@ func From(r report.Report, opts lib.Options) Summary {
 	for name, metric := range r.Metrics {
 		names = append(names, name)
 		displayName := indentForMetric(name) + displayNameForMetric(name)
+		if metric.Approximated {
+			displayName += approximatedMark
+		}
 		displayNameWidth := strWidth(displayName)
 		if displayNameWidth > nameLenMax {
 			nameLenMax = displayNameWidth
@@ -75,10 +128,9 @@ func From(r report.Report, opts lib.Options) Summary {
 		if metric.Type == metrics.Trend {
 			cols := make([]string, numTrendColumns)
 			for i, tc := range opts.SummaryTrendStats {
-				value := fmt.Sprintf("%v", metric.Values[tc])
-				if tc != "count" {
-					value = humanizeValue(metric.Values[tc], metric, opts.SummaryTimeUnit.String)
-				}
+				value := humanizeTrendStat(metric.Values[tc], metric, tc, opts.SummaryTimeUnit.String)
+				value = decorate(value, palette["cyan"]) + intervalForSum(metric, tc, opts.SummaryTimeUnit.String) +
+					deltaForSum(metric, tc, opts.SummaryTimeUnit.String)
 				valLen := strWidth(value)
 				if valLen > trendColMaxLens[i] {
 					trendColMaxLens[i] = valLen
@@ -91,7 +143,10 @@ func From(r report.Report, opts lib.Options) Summary {
 
 		values := nonTrendMetricValueForSum(metric, opts.SummaryTimeUnit.String)
 		nonTrendValues[name] = values[0]
-		valueLen := strWidth(values[0])
+		mainStat := mainStatForMetric(metric)
+		nonTrendDeltas[name] = intervalForSum(metric, mainStat, opts.SummaryTimeUnit.String) +
+			deltaForSum(metric, mainStat, opts.SummaryTimeUnit.String)
+		valueLen := strWidth(values[0] + nonTrendDeltas[name])
 		if valueLen > nonTrendValueMaxLen {
 			nonTrendValueMaxLen = valueLen
 		}
@@ -114,15 +169,15 @@ func From(r report.Report, opts lib.Options) Summary {
 			for i, col := range cols {
 				tmpCols[i] = fmt.Sprintf("%s=%s%s",
 					opts.SummaryTrendStats[i],
-					decorate(col, palette["cyan"]),
+					col,
 					strings.Repeat(" ", trendColMaxLens[i]-strWidth(col)),
 				)
 			}
 			return strings.Join(tmpCols, " ")
 		}
 
-		value := nonTrendValues[name]
-		fmtData := decorate(value, palette["cyan"]) + strings.Repeat(" ", nonTrendValueMaxLen-strWidth(value))
+		value, delta := nonTrendValues[name], nonTrendDeltas[name]
+		fmtData := decorate(value, palette["cyan"]) + delta + strings.Repeat(" ", nonTrendValueMaxLen-strWidth(value+delta))
 
 		extras := nonTrendExtras[name]
 		if len(extras) == 1 {
@@ -139,20 +194,357 @@ func From(r report.Report, opts lib.Options) Summary {
 		return fmtData
 	}
 
+	breached := make(map[string]struct{}, len(r.Breaches))
+	for _, b := range r.Breaches {
+		breached[b.Tolerance.Metric] = struct{}{}
+	}
+
+	anyApproximated := false
 	for _, name := range names {
 		mark := " "
 		markColor := func(text string) string { return text }
+		if _, isBreached := breached[name]; isBreached {
+			mark = "✗"
+			markColor = func(text string) string { return decorate(text, palette["red"]) }
+		}
 
 		fmtIndent := indentForMetric(name)
 		fmtName := displayNameForMetric(name)
+		if r.Metrics[name].Approximated {
+			fmtName += decorate(approximatedMark, palette["faint"])
+			anyApproximated = true
+		}
 		fmtName += decorate(strings.Repeat(".", nameLenMax-strWidth(fmtName)-strWidth(fmtIndent)+3)+":", palette["faint"])
 
 		s = append(s, indent+fmtIndent+markColor(mark)+" "+fmtName+" "+getData(name))
+		if d := r.Metrics[name].Distribution; d != nil {
+			s = append(s, distributionForSum(d, r.Metrics[name], opts, layout, indent+fmtIndent+"    ")...)
+		}
+	}
+
+	if anyApproximated {
+		s = append(s, "", indent+decorate(strings.TrimSpace(approximatedMark)+" approximated values, from a non-exact trend sink", palette["faint"]))
+	}
+
+	s = append(s, accuracyForSum(r, names, opts, indent)...)
+	s = append(s, histogramsForSum(r, names, opts, layout, indent)...)
+	s = append(s, apdexForSum(r, names, opts, indent)...)
+
+	if len(r.Breaches) > 0 {
+		s = append(s, "")
+		for _, b := range r.Breaches {
+			s = append(s, indent+decorate("✗", palette["red"])+" "+breachForSum(b, r.Metrics[b.Tolerance.Metric], opts.SummaryTimeUnit.String))
+		}
 	}
 
 	return s
 }
 
+// approximatedMark is appended to the name of the metrics whose values are approximated.
+const approximatedMark = " ≈"
+
+// accuracyForSum returns the lines of the summary section that shows, for each metric checked
+// in the accuracy self-check mode, the relative error of its trend stats against the exact ones.
+// It returns no lines if there are no checked metrics.
+func accuracyForSum(r report.Report, names []string, opts lib.Options, indent string) []string {
+	var checked []string
+	nameLenMax := 0
+	colMaxLens := make([]int, len(opts.SummaryTrendStats))
+	cols := map[string][]string{}
+
+	for _, name := range names {
+		metric := r.Metrics[name]
+		if len(metric.Accuracy) == 0 {
+			continue
+		}
+
+		checked = append(checked, name)
+		if nameLen := strWidth(indentForMetric(name) + displayNameForMetric(name)); nameLen > nameLenMax {
+			nameLenMax = nameLen
+		}
+
+		cols[name] = make([]string, len(opts.SummaryTrendStats))
+		for i, tc := range opts.SummaryTrendStats {
+			value := "-"
+			if e, ok := metric.Accuracy[tc]; ok {
+				value = fmt.Sprintf("%+.2f%%", e.Pct)
+			}
+			if valLen := strWidth(value); valLen > colMaxLens[i] {
+				colMaxLens[i] = valLen
+			}
+			cols[name][i] = value
+		}
+	}
+
+	if len(checked) == 0 {
+		return nil
+	}
+
+	lines := []string{"", indent + "accuracy check (relative error of the approximated values against the exact ones):"}
+	for _, name := range checked {
+		fmtIndent := indentForMetric(name)
+		fmtName := displayNameForMetric(name)
+		fmtName += decorate(strings.Repeat(".", nameLenMax-strWidth(fmtName)-strWidth(fmtIndent)+3)+":", palette["faint"])
+
+		fmtCols := make([]string, len(opts.SummaryTrendStats))
+		for i, col := range cols[name] {
+			fmtCols[i] = fmt.Sprintf("%s=%s%s",
+				opts.SummaryTrendStats[i],
+				decorate(col, palette["cyan"]),
+				strings.Repeat(" ", colMaxLens[i]-strWidth(col)),
+			)
+		}
+
+		lines = append(lines, indent+fmtIndent+"  "+fmtName+" "+strings.Join(fmtCols, " "))
+	}
+
+	return lines
+}
+
+// histogramsForSum returns the lines of the summary sections that show, for each metric with
+// a report.Histogram, the count and the (cumulative) percentage of values in each bucket,
+// along with a bar proportional to the count. It returns no lines if there are no histograms.
+// The bars are as wide as the Layout allows, like in distributionForSum.
+func histogramsForSum(r report.Report, names []string, opts lib.Options, layout Layout, indent string) []string {
+	barChar, decorateBar := barStyleFor(layout)
+
+	var lines []string
+	for _, name := range names {
+		metric := r.Metrics[name]
+		h := metric.Histogram
+		if h == nil {
+			continue
+		}
+
+		labels, labelLenMax := bucketLabelsForSum(h, metric, opts, layout)
+
+		counts := make([]string, len(h.Counts))
+		countLenMax := 0
+		var countMax uint64
+		for i, count := range h.Counts {
+			counts[i] = strconv.FormatUint(count, 10)
+			if countLen := strWidth(counts[i]); countLen > countLenMax {
+				countLenMax = countLen
+			}
+			if count > countMax {
+				countMax = count
+			}
+		}
+
+		// Besides the bar, each line has the indentation, the label, the
+		// count and both percentages (e.g. " 12.34%  56.78%"), separated.
+		barWidth := barWidthFor(layout, strWidth(indent)+len("  ")+labelLenMax+len(" ")+len(" ")+
+			countLenMax+len(" 100.00%  100.00%"))
+
+		lines = append(lines, "", indent+name+" distribution:")
+		for i, count := range h.Counts {
+			barLen := 0
+			if countMax > 0 {
+				barLen = int(math.Round(float64(count) / float64(countMax) * float64(barWidth)))
+			}
+
+			pct := 0.0
+			if i == 0 {
+				pct = h.Cumulative[0]
+			} else {
+				pct = h.Cumulative[i] - h.Cumulative[i-1]
+			}
+
+			lines = append(lines, fmt.Sprintf("%s  %s%s %s%s %s%s %s",
+				indent,
+				strings.Repeat(" ", labelLenMax-strWidth(labels[i])), labels[i],
+				decorateBar(strings.Repeat(barChar, barLen)), strings.Repeat(" ", barWidth-barLen),
+				strings.Repeat(" ", countLenMax-strWidth(counts[i])), decorate(counts[i], palette["cyan"]),
+				decorate(fmt.Sprintf("%6.2f%% %7.2f%%", pct, h.Cumulative[i]), palette["faint"]),
+			))
+		}
+	}
+
+	return lines
+}
+
+// apdexForSum returns the lines of the summary section that shows, for each metric with a
+// report.Apdex, its score and rating, its target T, and the number of values in each zone,
+// along with the difference against the baseline, if any. It returns no lines if there are none.
+func apdexForSum(r report.Report, names []string, opts lib.Options, indent string) []string {
+	var withApdex []string
+	nameLenMax := 0
+	colMaxLens := make([]int, 6)
+	cols := map[string][]string{}
+
+	for _, name := range names {
+		metric := r.Metrics[name]
+		a := metric.Apdex
+		if a == nil {
+			continue
+		}
+
+		withApdex = append(withApdex, name)
+		if nameLen := strWidth(indentForMetric(name) + displayNameForMetric(name)); nameLen > nameLenMax {
+			nameLenMax = nameLen
+		}
+
+		ratingColor := palette["faint"]
+		switch a.Rating() {
+		case "excellent", "good":
+			ratingColor = palette["green"]
+		case "poor", "unacceptable":
+			ratingColor = palette["red"]
+		}
+
+		cols[name] = []string{
+			// Truncated, so the score is consistent with the rating (e.g. 0.499 is shown as 0.49, as it is unacceptable).
+			decorate(fmt.Sprintf("%.2f", math.Floor(a.Score*100)/100), palette["cyan"]) + deltaForSum(metric, "apdex", opts.SummaryTimeUnit.String),
+			decorate(a.Rating(), ratingColor),
+			"T=" + humanizeValue(a.T, metric, opts.SummaryTimeUnit.String),
+			"satisfied=" + strconv.FormatUint(a.Satisfied, 10),
+			"tolerating=" + strconv.FormatUint(a.Tolerating, 10),
+			"frustrated=" + strconv.FormatUint(a.Frustrated, 10),
+		}
+		for i, col := range cols[name] {
+			if colLen := strWidth(col); colLen > colMaxLens[i] {
+				colMaxLens[i] = colLen
+			}
+		}
+	}
+
+	if len(withApdex) == 0 {
+		return nil
+	}
+
+	lines := []string{"", indent + "apdex:"}
+	for _, name := range withApdex {
+		fmtIndent := indentForMetric(name)
+		fmtName := displayNameForMetric(name)
+		fmtName += decorate(strings.Repeat(".", nameLenMax-strWidth(fmtName)-strWidth(fmtIndent)+3)+":", palette["faint"])
+
+		fmtCols := make([]string, len(cols[name]))
+		for i, col := range cols[name] {
+			fmtCols[i] = col + strings.Repeat(" ", colMaxLens[i]-strWidth(col))
+		}
+
+		lines = append(lines, indent+fmtIndent+"  "+fmtName+" "+strings.Join(fmtCols, " "))
+	}
+
+	return lines
+}
+
+// distributionForSum returns the lines of the given distribution, rendered as a compact histogram
+// with the percentage of values in each bucket, each one prefixed by the given indentation.
+// The bars are as wide as the Layout allows, with plain ASCII characters for plain layouts.
+func distributionForSum(d *report.Histogram, metric report.Metric, opts lib.Options, layout Layout, indent string) []string {
+	labels, labelLenMax := bucketLabelsForSum(d, metric, opts, layout)
+
+	// Besides the bar, each line has the indentation,
+	// the label and the percentage (e.g. " 12.34%").
+	barWidth := barWidthFor(layout, strWidth(indent)+labelLenMax+len(" ")+len(" 100.00%"))
+
+	var total, countMax uint64
+	for _, count := range d.Counts {
+		total += count
+		if count > countMax {
+			countMax = count
+		}
+	}
+
+	barChar, decorateBar := barStyleFor(layout)
+
+	lines := make([]string, 0, len(d.Counts))
+	for i, count := range d.Counts {
+		barLen, pct := 0, 0.0
+		if countMax > 0 {
+			barLen = int(math.Round(float64(count) / float64(countMax) * float64(barWidth)))
+			pct = float64(count) / float64(total) * 100
+		}
+
+		lines = append(lines, fmt.Sprintf("%s%s%s %s%s %s",
+			indent,
+			strings.Repeat(" ", labelLenMax-strWidth(labels[i])), decorate(labels[i], palette["faint"]),
+			decorateBar(strings.Repeat(barChar, barLen)), strings.Repeat(" ", barWidth-barLen),
+			decorate(fmt.Sprintf("%6.2f%%", pct), palette["faint"]),
+		))
+	}
+
+	return lines
+}
+
+// bucketLabelsForSum returns the labels of the buckets of the given histogram (e.g. "≤ 200ms",
+// or "<= 200ms" for plain layouts), along with the width of the widest one.
+func bucketLabelsForSum(h *report.Histogram, metric report.Metric, opts lib.Options, layout Layout) ([]string, int) {
+	le := "≤ "
+	if layout.Plain {
+		le = "<= "
+	}
+
+	labels := make([]string, len(h.Counts))
+	labelLenMax := 0
+	for i := range h.Counts {
+		if i < len(h.Bounds) {
+			labels[i] = le + humanizeValue(h.Bounds[i], metric, opts.SummaryTimeUnit.String)
+		} else {
+			labels[i] = "> " + humanizeValue(h.Bounds[len(h.Bounds)-1], metric, opts.SummaryTimeUnit.String)
+		}
+		if labelLen := strWidth(labels[i]); labelLen > labelLenMax {
+			labelLenMax = labelLen
+		}
+	}
+
+	return labels, labelLenMax
+}
+
+// barWidthFor returns the width of the histogram bars, that take the rest of the
+// line, besides the given number of columns used by the rest of it, within limits.
+func barWidthFor(layout Layout, used int) int {
+	const barWidthMin, barWidthMax = 10, 50
+
+	width := layout.Width
+	if width <= 0 {
+		width = defaultWidth
+	}
+
+	barWidth := width - used
+	if barWidth < barWidthMin {
+		return barWidthMin
+	}
+	if barWidth > barWidthMax {
+		return barWidthMax
+	}
+	return barWidth
+}
+
+// barStyleFor returns the character the histogram bars are made of, and how they're
+// decorated, for the given Layout: plain layouts use plain ASCII characters.
+func barStyleFor(layout Layout) (string, func(string) string) {
+	if layout.Plain {
+		return "#", func(bar string) string { return bar }
+	}
+	return "█", func(bar string) string { return decorate(bar, palette["cyan"]) }
+}
+
+// breachForSum returns a human-readable description of the given report.Breach.
+func breachForSum(b report.Breach, metric report.Metric, timeUnit string) string {
+	diff := b.Diff()
+	sign := "+"
+	if diff < 0 {
+		sign = "-"
+	}
+
+	value := sign + humanizeValue(math.Abs(diff), metric, timeUnit)
+	if metric.Type == metrics.Trend {
+		value = sign + humanizeTrendStat(math.Abs(diff), metric, b.Tolerance.Stat, timeUnit)
+	}
+	if b.Tolerance.Relative {
+		value = fmt.Sprintf("%s%.2f%%", sign, math.Abs(diff))
+	}
+	if math.IsInf(diff, 0) {
+		// Any relative change from a zero baseline.
+		value = sign + "∞%"
+	}
+
+	return fmt.Sprintf("%s %s changed %s against the baseline, exceeding the tolerance (%s)",
+		b.Tolerance.Metric, b.Tolerance.Stat, decorate(value, palette["red"]), b.Tolerance)
+}
+
 func indentForMetric(name string) string {
 	if strings.Contains(name, "{") {
 		return "  "
@@ -198,13 +590,30 @@ func strWidth(s string) int {
 
 		// If not in escape sequence, increase width
 		if !inEscSeq && !inLongEscSeq {
-			// Use utf8.RuneLen to account for multi-byte characters
-			width += utf8.RuneLen(char)
+			// Each character takes one column, even multi-byte ones (e.g. "≈")
+			width++
 		}
 	}
 	return width
 }
 
+// humanizeTrendStat is like humanizeValue, but for the given stat of a trend
+// metric, as not all of them are in the unit of its values (e.g. the count).
+func humanizeTrendStat(val float64, metric report.Metric, stat string, timeUnit string) string {
+	switch {
+	case stat == "count":
+		return fmt.Sprintf("%v", val)
+	case stat == "variance" || stat == "cv" || stat == "apdex":
+		// The variance is in squared units, and the coefficient of variation and the Apdex score have no unit.
+		return toFixedNoTrailingZeros(val, 6)
+	case strings.HasPrefix(stat, "pr("):
+		// Percentile ranks are a fraction of the values, like rates.
+		return toFixedNoTrailingZeros(val*100, 2) + "%"
+	default:
+		return humanizeValue(val, metric, timeUnit)
+	}
+}
+
 func humanizeValue(val float64, metric report.Metric, timeUnit string) string {
 	if metric.Type == metrics.Rate {
 		// Truncate instead of round to 2 decimal places
@@ -333,6 +742,69 @@ func nonTrendMetricValueForSum(metric report.Metric, timeUnit string) []string {
 	}
 }
 
+// mainStatForMetric returns the stat that is displayed as the main value
+// in the summary, for non-trend metrics (see nonTrendMetricValueForSum).
+func mainStatForMetric(metric report.Metric) string {
+	switch metric.Type {
+	case metrics.Counter:
+		return "count"
+	case metrics.Gauge:
+		return "value"
+	default:
+		return "rate"
+	}
+}
+
+// intervalForSum returns the margin of the confidence interval of the given stat, if any
+// (e.g. " ±4ms"), that is, half of its width, as it isn't necessarily symmetric.
+func intervalForSum(metric report.Metric, stat string, timeUnit string) string {
+	interval, ok := metric.Intervals[stat]
+	if !ok {
+		return ""
+	}
+
+	margin := (interval.Upper - interval.Lower) / 2
+	text := humanizeValue(margin, metric, timeUnit)
+	if metric.Type == metrics.Trend {
+		text = humanizeTrendStat(margin, metric, stat, timeUnit)
+	}
+
+	return " " + decorate("±"+text, palette["faint"])
+}
+
+// deltaForSum returns the difference of the given stat against the baseline, if any,
+// (e.g. " (+4ms, +3.40%)"), colored by whether it is an improvement or not.
+func deltaForSum(metric report.Metric, stat string, timeUnit string) string {
+	d, ok := metric.Deltas[stat]
+	if !ok {
+		return ""
+	}
+
+	sign := "+"
+	if d.Abs < 0 {
+		sign = "-"
+	}
+
+	text := sign + humanizeValue(math.Abs(d.Abs), metric, timeUnit)
+	if metric.Type == metrics.Trend {
+		text = sign + humanizeTrendStat(math.Abs(d.Abs), metric, stat, timeUnit)
+	}
+	// For rates, the absolute difference is already a percentage.
+	if metric.Type != metrics.Rate && d.Baseline != 0 {
+		text += fmt.Sprintf(", %s%.2f%%", sign, math.Abs(d.Pct))
+	}
+
+	color := palette["faint"]
+	switch d.Verdict {
+	case report.VerdictBetter:
+		color = palette["green"]
+	case report.VerdictWorse:
+		color = palette["red"]
+	}
+
+	return " " + decorate("("+text+")", color)
+}
+
 func decorate(text string, colorCode string, additionalCodes ...string) string {
 	result := "\x1b[" + colorCode
 	for _, code := range additionalCodes {
@@ -343,5 +815,7 @@ func decorate(text string, colorCode string, additionalCodes ...string) string {
 
 var palette = map[string]string{
 	"faint": "2",
+	"red":   "31",
+	"green": "32",
 	"cyan":  "36",
 }
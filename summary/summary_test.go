@@ -0,0 +1,132 @@
+package summary
+
+import (
+	"strings"
+	"testing"
+
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/report"
+	"github.com/joanlopez/xk6-custosummary/timeseries"
+)
+
+func TestFromWithLayout(t *testing.T) {
+	t.Parallel()
+
+	// The labels of the buckets (e.g. "≤ 100ms") are 7 columns wide.
+	buckets := &report.Histogram{
+		Bounds:     []float64{10, 100},
+		Counts:     []uint64{1, 5, 2},
+		Cumulative: []float64{12.5, 75, 100},
+	}
+	r := report.Report{Metrics: map[string]report.Metric{
+		"http_req_duration": {
+			Meta:         timeseries.Meta{Type: metrics.Trend, Contains: metrics.Time},
+			Values:       report.Values{"avg": 50},
+			Histogram:    buckets,
+			Distribution: buckets,
+		},
+	}}
+	opts := lib.Options{SummaryTrendStats: []string{"avg"}}
+
+	for _, tc := range []struct {
+		name   string
+		layout Layout
+		// The expected width of the lines of the distribution and the histogram, along with
+		// the one of their widest bar, as the bars take the rest of the line, within limits.
+		distributionWidth, distributionBar int
+		histogramWidth, histogramBar       int
+	}{
+		{
+			name:   "fits in the width",
+			layout: Layout{Width: 60},
+			// The distribution lines have the indentation (7 columns), the label,
+			// and the percentage (8 columns), besides the bar, separated by a space.
+			distributionWidth: 60, distributionBar: 37,
+			// The histogram lines have the indentation (5 columns), the label, the count
+			// (1 column) and both percentages (16 columns), besides the bar, separated.
+			histogramWidth: 60, histogramBar: 28,
+		},
+		{
+			name:              "default width",
+			layout:            Layout{},
+			distributionWidth: 73, distributionBar: 50,
+			histogramWidth: 80, histogramBar: 48,
+		},
+		{
+			name:              "wider than the widest bars",
+			layout:            Layout{Width: 200},
+			distributionWidth: 73, distributionBar: 50,
+			histogramWidth: 82, histogramBar: 50,
+		},
+		{
+			name:              "narrower than the narrowest bars",
+			layout:            Layout{Width: 20},
+			distributionWidth: 33, distributionBar: 10,
+			histogramWidth: 42, histogramBar: 10,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			distribution, histogram := bucketLines(t, FromWith(r, opts, tc.layout))
+			assertBucketLines(t, "distribution", distribution, "█", tc.distributionWidth, tc.distributionBar)
+			assertBucketLines(t, "histogram", histogram, "█", tc.histogramWidth, tc.histogramBar)
+		})
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		t.Parallel()
+
+		s := FromWith(r, opts, Layout{Width: 60, Plain: true})
+		distribution, histogram := bucketLines(t, s.WithoutColors())
+		// The plain labels (e.g. "<= 100ms") are one column wider, so the bars are narrower.
+		assertBucketLines(t, "distribution", distribution, "#", 60, 36)
+		assertBucketLines(t, "histogram", histogram, "#", 60, 27)
+
+		for _, line := range append(distribution, histogram...) {
+			if strings.ContainsAny(line, "≤█") {
+				t.Errorf("expected plain characters only, got %q", line)
+			}
+			if !strings.Contains(line, "<= ") && !strings.Contains(line, "> ") {
+				t.Errorf("expected a plain bucket label, got %q", line)
+			}
+		}
+	})
+}
+
+// bucketLines returns the lines of the buckets of the distribution and the
+// histogram in the given summary, that are right below the metric line and
+// below the "distribution:" header, respectively.
+func bucketLines(t *testing.T, s Summary) (distribution, histogram []string) {
+	t.Helper()
+
+	var header int
+	for i, line := range s {
+		if strings.Contains(line, "http_req_duration distribution:") {
+			header = i
+		}
+	}
+	if header == 0 || header+4 > len(s) {
+		t.Fatalf("expected a histogram in the summary, got:\n%s", strings.Join(s, "\n"))
+	}
+
+	return s[1:4], s[header+1 : header+4]
+}
+
+// assertBucketLines checks that the given lines, one per bucket, are as wide as expected,
+// and that the bar of the most populated bucket (the second one) is as wide as expected.
+func assertBucketLines(t *testing.T, name string, lines []string, barChar string, width, barWidth int) {
+	t.Helper()
+
+	for _, line := range lines {
+		if got := strWidth(line); got != width {
+			t.Errorf("%s: expected lines %d columns wide, got %d: %q", name, width, got, line)
+		}
+	}
+	if got := strings.Count(lines[1], barChar); got != barWidth {
+		t.Errorf("%s: expected the widest bar to be %d columns wide, got %d: %q", name, barWidth, got, lines[1])
+	}
+}
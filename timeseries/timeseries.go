@@ -1,6 +1,7 @@
 package timeseries
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 
@@ -9,6 +10,7 @@ import (
 	"go.k6.io/k6/metrics"
 
 	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
 )
 
 // Collection is a collection of time series.
@@ -30,6 +32,12 @@ func (c Collection) AddSample(s metrics.Sample) {
 // If there's no Sink for that time series yet stored in the collection,
 // it is also responsible for its initialization.
 func (c Collection) AddMetricSample(m *metrics.Metric, s metrics.Sample) {
+	c.AddMetricSampleWith(m, s, nil)
+}
+
+// AddMetricSampleWith is like AddMetricSample, but the trend sinks of new
+// time series are initialized with the given trend.SinkTypes (see sink.NewFor).
+func (c Collection) AddMetricSampleWith(m *metrics.Metric, s metrics.Sample, types *trend.SinkTypes) {
 	k := NewKey(metrics.TimeSeries{
 		Metric: m,
 		Tags:   s.TimeSeries.Tags,
@@ -42,50 +50,123 @@ func (c Collection) AddMetricSample(m *metrics.Metric, s metrics.Sample) {
 				Type:     m.Type,
 				Contains: m.Contains,
 			},
-			Sink: sink.New(m.Type),
+			Sink: sink.NewFor(m, types),
 		}
 	}
 
 	c[k].Sink.Add(s)
 }
 
+// Filter returns a new Collection with only the time series
+// whose key satisfies the given predicate.
+func (c Collection) Filter(keep func(Key) bool) Collection {
+	result := NewCollection()
+	for key, ts := range c {
+		if keep(key) {
+			result[key] = ts
+		}
+	}
+	return result
+}
+
+// OutOfRange returns, for each metric, the number of values that couldn't be
+// recorded because they are out of the range of their trend sinks (see
+// sink.TrendSink.OutOfRange). Metrics without such values are omitted.
+func (c Collection) OutOfRange() map[string]uint64 {
+	result := make(map[string]uint64)
+	for key, ts := range c {
+		if typed, ok := ts.Sink.(*sink.TrendSink); ok {
+			if n := typed.OutOfRange(); n > 0 {
+				result[key.MetricName()] += n
+			}
+		}
+	}
+	return result
+}
+
+// Sort sorts the values kept by the trend sinks (see sink.TrendSink.Sort), so
+// getting the time series (see Get) merges them without copying them. It is
+// meant to be called once no more samples are added (e.g. before writing a
+// snapshot), as sorting them again after every sample would be too expensive.
+func (c Collection) Sort() {
+	for _, ts := range c {
+		if typed, ok := ts.Sink.(*sink.TrendSink); ok {
+			typed.Sort()
+		}
+	}
+}
+
 // Get returns a TimeSeries that matches the given key.
 //
 // Use NewKey to create a key from a TimeSeries.
 //
-// This method merges all the time series that match the key prefix, so it behaves like a Prometheus query:
+// This method merges all the time series that match the key (see Key.Matches), so it behaves like a Prometheus query:
 //   - http_reqs{} => will return a time series with all the values from the `http_reqs` metric.
 //   - http_reqs{group='auth'} => will return a time series with all the values from the `http_reqs` metric, tagged with `group=auth`.
-func (c Collection) Get(get Key) *TimeSeries {
+//
+// It returns nil if there are no matching time series, and an error if they cannot be merged,
+// because their sinks are incompatible (e.g. different trend sinks, see Collection.Validate).
+// The returned time series may share the values of the stored ones, so it must not be used
+// once the collection is modified (e.g. by AddMetricSample).
+func (c Collection) Get(get Key) (*TimeSeries, error) {
 	// We merge all the stored time series that matches
-	// the key prefix.
-	var result *TimeSeries
+	// the given key, all at once (see sink.MergeAll).
+	var (
+		meta  Meta
+		sinks []sink.Sink
+	)
 	for key, ts := range c {
-		// If the time series key is a prefix of the given key,
-		// we merge the sink. If not, we skip it.
-		if !strings.HasPrefix(string(key), string(get)) {
+		// If the time series key matches the given key,
+		// we keep the sink to merge it. If not, we skip it.
+		if !key.Matches(get) {
 			continue
 		}
 
-		// If we don't have a totalSink yet, we initialize it
-		// with the same type as the time series sink.
-		if result == nil {
-			result = &TimeSeries{
-				Key:  get,
-				Meta: ts.Meta,
-				Sink: sink.New(ts.Meta.Type),
-			}
+		meta = ts.Meta
+		sinks = append(sinks, ts.Sink)
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	merged, err := sink.MergeAll(sinks...)
+	if err != nil {
+		return nil, fmt.Errorf("inconsistent time series for %s: %w", get, err)
+	}
+
+	return &TimeSeries{Key: get, Meta: meta, Sink: merged}, nil
+}
+
+// Validate checks that all the time series of each metric have the same shape
+// and compatible sinks, so they can be merged (see Get). That is always the case
+// for the ones collected by a single output, but not necessarily for the ones
+// merged from different sources (e.g. load generators with different trend sinks).
+func (c Collection) Validate() error {
+	first := make(map[string]TimeSeries)
+	for _, ts := range c {
+		name := ts.Key.MetricName()
+		other, seen := first[name]
+		if !seen {
+			first[name] = ts
+			continue
+		}
+
+		if ts.Meta != other.Meta {
+			return fmt.Errorf("inconsistent time series for %s: %s and %s have different shapes", name, other.Key, ts.Key)
+		}
+		if err := sink.Compatible(other.Sink, ts.Sink); err != nil {
+			return fmt.Errorf("inconsistent time series for %s: %w", name, err)
 		}
-		result.Sink.Merge(ts.Sink)
 	}
 
-	return result
+	return nil
 }
 
 // Meta defines the shape (metric and values type) of a time series.
 type Meta struct {
-	Type     metrics.MetricType
-	Contains metrics.ValueType
+	Type     metrics.MetricType `json:"type"`
+	Contains metrics.ValueType  `json:"contains"`
 }
 
 // TimeSeries holds all the values of a given time series,
@@ -106,13 +187,92 @@ type Key string
 //   - http_reqs{} => NewKey(metrics.TimeSeries{Metric: &metrics.Metric{Name: "http_reqs"}}).
 //   - http_reqs{group='auth'} => NewKey(metrics.TimeSeries{Metric: &metrics.Metric{Name: "http_reqs"}, Tags: metrics.TagSet.With("group", "auth")}).
 func NewKey(ts metrics.TimeSeries) Key {
-	labelPairs := []string{"__name__=" + ts.Metric.Name}
-	for k, v := range normalizeTagSet(ts.Tags).Map() {
+	return newKey(ts.Metric.Name, normalizeTagSet(ts.Tags).Map())
+}
+
+// NewKeyFromTags returns a key for the given metric name and tags.
+// It is the equivalent of NewKey, but without a metrics.TimeSeries.
+func NewKeyFromTags(name string, tags map[string]string) Key {
+	return newKey(name, tags)
+}
+
+// ParseSelector returns the key that corresponds to the given selector,
+// so it can be used in combination with Collection.Get.
+//
+// The selector follows a style similar to Prometheus queries, but it also
+// accepts the notation used by k6 for sub-metrics:
+//   - http_reqs => all the values from the `http_reqs` metric.
+//   - http_reqs{scenario="api"} => the values from the `http_reqs` metric, tagged with `scenario=api`.
+//   - http_reqs{scenario:api,group:::auth} => same, but using the k6 sub-metrics notation.
+func ParseSelector(selector string) (Key, error) {
+	selector = strings.TrimSpace(selector)
+
+	name, rawTags, hasTags := strings.Cut(selector, "{")
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return "", fmt.Errorf("invalid selector '%s', metric name is missing", selector)
+	}
+
+	if !hasTags {
+		return newKey(name, nil), nil
+	}
+
+	if !strings.HasSuffix(rawTags, "}") {
+		return "", fmt.Errorf("invalid selector '%s', missing closing brace", selector)
+	}
+
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(strings.TrimSuffix(rawTags, "}"), ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		// Both `key="value"` (Prometheus) and `key:value` (k6) are accepted.
+		k, v, found := strings.Cut(pair, "=")
+		if !found {
+			k, v, found = strings.Cut(pair, ":")
+		}
+		k = strings.TrimSpace(k)
+		if !found || len(k) == 0 {
+			return "", fmt.Errorf("invalid selector '%s', malformed tag '%s'", selector, pair)
+		}
+
+		tags[k] = strings.Trim(strings.TrimSpace(v), `"'`)
+	}
+
+	return newKey(name, tags), nil
+}
+
+// newKey returns a key for the given metric name and tags,
+// with the labels sorted to ensure that the key is always the same.
+// The metric name always comes first, as `__name__`.
+func newKey(name string, tags map[string]string) Key {
+	labelPairs := make([]string, 0, len(tags))
+	for k, v := range tags {
 		// FIXME: Find a more efficient way to do this, like hashing.
 		labelPairs = append(labelPairs, k+"="+v)
 	}
 	sort.Strings(labelPairs)
-	return Key(strings.Join(labelPairs, "|"))
+	return Key(strings.Join(append([]string{"__name__=" + name}, labelPairs...), "|"))
+}
+
+// Matches returns whether the key matches the given one, used as a selector.
+// That is, whether both refer to the same metric and all the labels present
+// in the selector are also present in the key, with the same value.
+func (k Key) Matches(selector Key) bool {
+	name := selector.MetricNameKey()
+	if k != name && !strings.HasPrefix(string(k), string(name)+"|") {
+		return false
+	}
+
+	for _, pair := range strings.Split(string(selector), "|")[1:] {
+		if !strings.Contains(string(k), "|"+pair+"|") &&
+			!strings.HasSuffix(string(k), "|"+pair) {
+			return false
+		}
+	}
+
+	return true
 }
 
 // MetricName returns the metric name from the key.
@@ -123,6 +283,18 @@ func (k Key) MetricName() string {
 	return strings.Split(strings.Split(string(k), "|")[0], "=")[1]
 }
 
+// Tags returns the tags (labels) from the key, except the metric name.
+func (k Key) Tags() map[string]string {
+	pairs := strings.Split(string(k), "|")[1:]
+	tags := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		if name, value, found := strings.Cut(pair, "="); found {
+			tags[name] = value
+		}
+	}
+	return tags
+}
+
 // MetricNameKey returns a Key with only the metric name.
 // It can be used in combination with Collection.Get,
 // to get a time series with all the values from a given metric, despite the tags.
@@ -0,0 +1,242 @@
+package timeseries
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.k6.io/k6/metrics"
+
+	"github.com/joanlopez/xk6-custosummary/sink"
+	"github.com/joanlopez/xk6-custosummary/sink/trend"
+)
+
+func TestParseSelector(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		selector string
+		want     Key
+	}{
+		{selector: "http_reqs", want: newKey("http_reqs", nil)},
+		{selector: "  http_reqs  ", want: newKey("http_reqs", nil)},
+		{selector: "http_reqs{}", want: newKey("http_reqs", nil)},
+		{selector: `http_reqs{scenario="api"}`, want: newKey("http_reqs", map[string]string{"scenario": "api"})},
+		{selector: `http_reqs{scenario='api'}`, want: newKey("http_reqs", map[string]string{"scenario": "api"})},
+		{selector: "http_reqs{scenario:api}", want: newKey("http_reqs", map[string]string{"scenario": "api"})},
+		{
+			selector: `http_reqs { scenario = "api" , group:::auth, }`,
+			want:     newKey("http_reqs", map[string]string{"scenario": "api", "group": "::auth"}),
+		},
+		{
+			// The order of the tags doesn't matter.
+			selector: "http_reqs{status:200,method:GET}",
+			want:     newKey("http_reqs", map[string]string{"method": "GET", "status": "200"}),
+		},
+	} {
+		got, err := ParseSelector(tc.selector)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.selector, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.selector, tc.want, got)
+		}
+	}
+
+	for _, selector := range []string{
+		"",
+		"   ",
+		`{scenario="api"}`,
+		`http_reqs{scenario="api"`,
+		"http_reqs{scenario}",
+		`http_reqs{="api"}`,
+		"http_reqs{:api}",
+	} {
+		if _, err := ParseSelector(selector); err == nil {
+			t.Errorf("%q: expected an error", selector)
+		}
+	}
+}
+
+func TestKeyMatches(t *testing.T) {
+	t.Parallel()
+
+	key := newKey("http_reqs", map[string]string{"scenario": "api", "status": "200"})
+
+	for _, tc := range []struct {
+		selector string
+		want     bool
+	}{
+		{selector: "http_reqs", want: true},
+		{selector: "http_reqs{scenario:api}", want: true},
+		{selector: "http_reqs{status:200}", want: true},
+		{selector: "http_reqs{status:200,scenario:api}", want: true},
+		{selector: "http_reqs{scenario:ap}", want: false},
+		{selector: "http_reqs{scenario:api2}", want: false},
+		{selector: "http_reqs{status:200,scenario:web}", want: false},
+		{selector: "http_reqs{method:GET}", want: false},
+		{selector: "http_req", want: false},
+		{selector: "http_reqs_total", want: false},
+	} {
+		selector, err := ParseSelector(tc.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := key.Matches(selector); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.selector, tc.want, got)
+		}
+	}
+
+	// A key without tags only matches selectors without tags.
+	plain := newKey("http_reqs", nil)
+	if !plain.Matches(newKey("http_reqs", nil)) {
+		t.Error("expected a key to match itself")
+	}
+	if plain.Matches(newKey("http_reqs", map[string]string{"scenario": "api"})) {
+		t.Error("expected a key without tags not to match a selector with tags")
+	}
+}
+
+func TestCollectionValidate(t *testing.T) {
+	t.Parallel()
+
+	trendMeta := Meta{Type: metrics.Trend, Contains: metrics.Time}
+	newSeries := func(key Key, meta Meta, s sink.Sink) TimeSeries {
+		return TimeSeries{Key: key, Meta: meta, Sink: s}
+	}
+
+	api := newKey("http_req_duration", map[string]string{"scenario": "api"})
+	web := newKey("http_req_duration", map[string]string{"scenario": "web"})
+
+	for _, tc := range []struct {
+		name    string
+		series  []TimeSeries
+		valid   bool
+		wantErr error
+	}{
+		{
+			name:  "consistent",
+			valid: true,
+			series: []TimeSeries{
+				newSeries(api, trendMeta, &sink.TrendSink{Sink: trend.NewHdrHistogramSink()}),
+				newSeries(web, trendMeta, &sink.TrendSink{Sink: trend.NewHdrHistogramSink()}),
+				newSeries(newKey("http_reqs", nil), Meta{Type: metrics.Counter}, sink.New(metrics.Counter)),
+			},
+		},
+		{
+			name: "different shapes",
+			series: []TimeSeries{
+				newSeries(api, trendMeta, &sink.TrendSink{Sink: trend.NewK6Sink()}),
+				newSeries(web, Meta{Type: metrics.Trend, Contains: metrics.Default}, &sink.TrendSink{Sink: trend.NewK6Sink()}),
+			},
+		},
+		{
+			name: "different sinks",
+			series: []TimeSeries{
+				newSeries(api, Meta{Type: metrics.Counter}, sink.New(metrics.Counter)),
+				newSeries(web, Meta{Type: metrics.Counter}, sink.New(metrics.Rate)),
+			},
+			wantErr: sink.ErrIncompatibleSinks,
+		},
+		{
+			name: "different trend sinks",
+			series: []TimeSeries{
+				newSeries(api, trendMeta, &sink.TrendSink{Sink: trend.NewK6Sink()}),
+				newSeries(web, trendMeta, &sink.TrendSink{Sink: trend.NewDDSketchHistogramSink()}),
+			},
+			wantErr: trend.ErrIncompatibleSinks,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := NewCollection()
+			for _, ts := range tc.series {
+				c[ts.Key] = ts
+			}
+
+			err := c.Validate()
+			if tc.valid {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+
+			// Those that don't validate cannot be merged either.
+			if _, err := c.Get(newKey("http_req_duration", nil)); tc.wantErr != nil && err == nil {
+				t.Fatal("expected an error from Get")
+			}
+		})
+	}
+}
+
+// BenchmarkCollectionGet compares getting the time series of a trend metric with
+// many time series (e.g. one per URL) by merging their sinks one by one into an
+// empty one (how Get used to merge them), and with Get (see sink.MergeAll). The
+// sinks are either unsorted, like the ones being collected by the output, or
+// sorted, like the ones in the snapshots (see Sort).
+func BenchmarkCollectionGet(b *testing.B) {
+	for _, sorted := range []bool{false, true} {
+		for _, count := range []int{10, 100, 1000} {
+			c := NewCollection()
+			r := rand.New(rand.NewSource(int64(count)))
+			for i := 0; i < count; i++ {
+				key := NewKeyFromTags("http_req_duration", map[string]string{"url": strconv.Itoa(i)})
+				ts := TimeSeries{
+					Key:  key,
+					Meta: Meta{Type: metrics.Trend, Contains: metrics.Time},
+					Sink: sink.New(metrics.Trend),
+				}
+				for j := 0; j < 1_000_000/count; j++ {
+					ts.Sink.Add(metrics.Sample{Value: r.ExpFloat64() * 100})
+				}
+				c[key] = ts
+			}
+			if sorted {
+				c.Sort()
+			}
+
+			get := NewKeyFromTags("http_req_duration", nil)
+			name := "sorted=" + strconv.FormatBool(sorted) + "/series=" + strconv.Itoa(count)
+
+			b.Run(name+"/merge", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					var merged sink.Sink
+					for key, ts := range c {
+						if !key.Matches(get) {
+							continue
+						}
+						if merged == nil {
+							merged = sink.NewLike(ts.Sink)
+						}
+						if err := merged.Merge(ts.Sink); err != nil {
+							b.Fatal(err)
+						}
+					}
+					merged.Format(time.Second)
+				}
+			})
+
+			b.Run(name+"/get", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					ts, err := c.Get(get)
+					if err != nil {
+						b.Fatal(err)
+					}
+					ts.Sink.Format(time.Second)
+				}
+			})
+		}
+	}
+}